@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/iwrk-platform/framework/migration"
+	"log"
+	"os"
+)
+
+func main() {
+	cmd := &migration.Command{
+		Dir: "./migrations",
+	}
+	if err := cmd.Run(context.Background(), os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+}
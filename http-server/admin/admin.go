@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/iwrk-platform/framework/http-server/frontend"
+	"github.com/uptrace/bun"
+)
+
+// RolesFunc returns roles of the authenticated user
+type RolesFunc func(ctx *fiber.Ctx) []string
+
+// Admin registers back-office resources on router and collects their side menu
+type Admin struct {
+	DB     *bun.DB
+	Router fiber.Router
+	Layout frontend.Layout
+	Roles  RolesFunc
+	Menu   []frontend.MenuRoute
+}
+
+// NewAdmin creates admin registrar, without roles func only routes without AllowedRoles are reachable
+func NewAdmin(db *bun.DB, router fiber.Router, layout frontend.Layout, roles RolesFunc) *Admin {
+	return &Admin{
+		DB:     db,
+		Router: router,
+		Layout: layout,
+		Roles:  roles,
+		Menu:   make([]frontend.MenuRoute, 0),
+	}
+}
+
+// AddMenu adds routes not backed by admin resources to the side menu
+func (a *Admin) AddMenu(routes ...frontend.MenuRoute) {
+	a.Menu = append(a.Menu, routes...)
+}
+
+// SideMenu returns menu routes allowed for the current user
+func (a *Admin) SideMenu(ctx *fiber.Ctx) []frontend.MenuRoute {
+	return frontend.FilterMenuRoutes(a.Menu, a.userRoles(ctx))
+}
+
+func (a *Admin) userRoles(ctx *fiber.Ctx) []string {
+	if a.Roles == nil {
+		return nil
+	}
+	return a.Roles(ctx)
+}
+
+func (a *Admin) allow(route frontend.MenuRoute) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !frontend.IsAllowedRoute(route, a.userRoles(ctx)) {
+			return fiber.ErrForbidden
+		}
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,317 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/iwrk-platform/formam/v3"
+	"github.com/iwrk-platform/framework/http-server/frontend"
+	"github.com/samber/lo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+const (
+	defaultPageSize    = 20
+	defaultMaxPageSize = 100
+)
+
+// Views renders resource pages, edit form errors are available with frontend.GetFormErrors
+type Views[T any] interface {
+	List(list *List[T]) frontend.Component
+	Detail(item *T) frontend.Component
+	Edit(item *T) frontend.Component
+}
+
+// Resource describes admin pages of bun model T
+type Resource[T any] struct {
+	Route        frontend.MenuRoute
+	SearchFields []string // columns matched by ILIKE against ListRequest.Search
+	SortFields   []string // columns allowed in ListRequest.Sort
+	DefaultSort  string   // column name, "-" prefix for descending order
+	// Fields columns create and edit forms may set, all columns except the primary key by default
+	Fields      []string
+	PageSize    int64
+	MaxPageSize int64 // largest limit a list request may ask for, 100 or PageSize if it is larger
+	// Views renders html pages, resource without views serves json endpoints
+	Views Views[T]
+}
+
+// ListRequest list page query parameters
+type ListRequest struct {
+	frontend.BaseRequest
+	Search string `json:"search"`
+	Sort   string `json:"sort"`
+}
+
+// List data of the list page
+type List[T any] struct {
+	Route   frontend.MenuRoute
+	Request ListRequest
+	Items   []T
+	Total   int
+}
+
+type resourceHandler[T any] struct {
+	admin    *Admin
+	resource Resource[T]
+	pk       *schema.Field
+	readonly []*schema.Field
+}
+
+// Register mounts list, detail, create, edit and delete endpoints of T under Route.Path
+// and adds Route to the admin side menu
+func Register[T any](a *Admin, resource Resource[T]) error {
+	table := a.DB.Table(reflect.TypeOf((*T)(nil)).Elem())
+	if len(table.PKs) != 1 {
+		return fmt.Errorf("admin resource %s must have exactly one primary key", table.TypeName)
+	}
+	defaultSort, _ := parseSort(resource.DefaultSort)
+	if defaultSort != "" {
+		resource.SortFields = append(append([]string(nil), resource.SortFields...), defaultSort)
+	}
+	columns := make([]string, 0, len(resource.SearchFields)+len(resource.SortFields)+len(resource.Fields))
+	columns = append(append(append(columns, resource.SearchFields...), resource.SortFields...), resource.Fields...)
+	for _, field := range columns {
+		if !table.HasField(field) {
+			return fmt.Errorf("admin resource %s has no column %s", table.TypeName, field)
+		}
+	}
+	if resource.PageSize <= 0 {
+		resource.PageSize = defaultPageSize
+	}
+	if resource.MaxPageSize <= 0 {
+		resource.MaxPageSize = defaultMaxPageSize
+	}
+	resource.MaxPageSize = max(resource.MaxPageSize, resource.PageSize)
+	h := &resourceHandler[T]{
+		admin:    a,
+		resource: resource,
+		pk:       table.PKs[0],
+	}
+	for _, field := range table.Fields {
+		if field.IsPK || (len(resource.Fields) > 0 && !lo.Contains(resource.Fields, field.Name)) {
+			h.readonly = append(h.readonly, field)
+		}
+	}
+
+	group := a.Router.Group(resource.Route.Path, a.allow(resource.Route))
+	group.Get("/", h.list)
+	group.Post("/", h.create)
+	group.Get("/new", h.new)
+	group.Get("/:id", h.detail)
+	group.Get("/:id/edit", h.edit)
+	group.Post("/:id", h.update)
+	group.Put("/:id", h.update)
+	group.Delete("/:id", h.delete)
+
+	a.Menu = append(a.Menu, resource.Route)
+	return nil
+}
+
+func (h *resourceHandler[T]) list(ctx *fiber.Ctx) error {
+	request, err := h.parseListRequest(ctx)
+	if err != nil {
+		return err
+	}
+	items := make([]T, 0)
+	query := h.admin.DB.NewSelect().Model(&items).Limit(int(request.Limit)).Offset(int(request.Offset))
+	if request.Search != "" && len(h.resource.SearchFields) > 0 {
+		search := "%" + escapeLike(request.Search) + "%"
+		query = query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			for _, field := range h.resource.SearchFields {
+				q = q.WhereOr("?TableAlias.?::text ILIKE ?", bun.Ident(field), search)
+			}
+			return q
+		})
+	}
+	if field, desc := parseSort(request.Sort); field != "" {
+		direction := "ASC"
+		if desc {
+			direction = "DESC"
+		}
+		query = query.OrderExpr("?TableAlias.? "+direction, bun.Ident(field))
+	}
+	total, err := query.ScanAndCount(ctx.Context())
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	list := &List[T]{
+		Route:   h.resource.Route,
+		Request: request,
+		Items:   items,
+		Total:   total,
+	}
+	if h.resource.Views == nil {
+		return ctx.JSON(list)
+	}
+	return frontend.Render(ctx, h.resource.Views.List(list), h.admin.Layout)
+}
+
+func (h *resourceHandler[T]) detail(ctx *fiber.Ctx) error {
+	item, err := h.find(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	if h.resource.Views == nil {
+		return ctx.JSON(item)
+	}
+	return frontend.Render(ctx, h.resource.Views.Detail(item), h.admin.Layout)
+}
+
+func (h *resourceHandler[T]) new(ctx *fiber.Ctx) error {
+	if h.resource.Views == nil {
+		return fiber.ErrNotFound
+	}
+	return frontend.RenderForm(ctx, frontend.FormErrors{}, h.resource.Views.Edit(new(T)), h.admin.Layout)
+}
+
+func (h *resourceHandler[T]) edit(ctx *fiber.Ctx) error {
+	item, err := h.find(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	if h.resource.Views == nil {
+		return ctx.JSON(item)
+	}
+	return frontend.RenderForm(ctx, frontend.FormErrors{}, h.resource.Views.Edit(item), h.admin.Layout)
+}
+
+func (h *resourceHandler[T]) create(ctx *fiber.Ctx) error {
+	item := new(T)
+	if errs := h.bind(ctx, item); !errs.IsEmpty() {
+		return h.invalid(ctx, item, errs)
+	}
+	if _, err := h.admin.DB.NewInsert().Model(item).Returning("*").Exec(ctx.Context()); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return h.saved(ctx, item, fiber.StatusCreated)
+}
+
+func (h *resourceHandler[T]) update(ctx *fiber.Ctx) error {
+	if ctx.FormValue("action") == "delete" {
+		return h.delete(ctx)
+	}
+	item, err := h.find(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	if errs := h.bind(ctx, item); !errs.IsEmpty() {
+		return h.invalid(ctx, item, errs)
+	}
+	if _, err = h.admin.DB.NewUpdate().Model(item).WherePK().Exec(ctx.Context()); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return h.saved(ctx, item, fiber.StatusOK)
+}
+
+func (h *resourceHandler[T]) delete(ctx *fiber.Ctx) error {
+	item, err := h.find(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err = h.admin.DB.NewDelete().Model(item).WherePK().Exec(ctx.Context()); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if h.resource.Views == nil {
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+	return frontend.Redirect(ctx, h.resource.Route.Path)
+}
+
+func (h *resourceHandler[T]) find(ctx context.Context, id string) (*T, error) {
+	item := new(T)
+	if err := h.pk.ScanValue(reflect.ValueOf(item).Elem(), id); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	if err := h.admin.DB.NewSelect().Model(item).WherePK().Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.ErrNotFound
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return item, nil
+}
+
+// bind sets item from the request body, read-only fields keep their values, so a client can not
+// set the primary key or columns missing in Resource.Fields
+func (h *resourceHandler[T]) bind(ctx *fiber.Ctx, item *T) frontend.FormErrors {
+	original := *item
+	defer func() {
+		v, o := reflect.ValueOf(item).Elem(), reflect.ValueOf(&original).Elem()
+		for _, field := range h.readonly {
+			field.Value(v).Set(field.Value(o))
+		}
+	}()
+	if h.resource.Views == nil {
+		errs := frontend.FormErrors{}
+		if err := ctx.BodyParser(item); err != nil {
+			errs.Add(frontend.FormErrorKey, err.Error())
+			return errs
+		}
+		if validator, ok := any(item).(frontend.FormValidator); ok {
+			for field, message := range validator.Validate(ctx.Context()) {
+				errs.Add(field, message)
+			}
+		}
+		return errs
+	}
+	return frontend.BindForm(ctx, item)
+}
+
+func (h *resourceHandler[T]) invalid(ctx *fiber.Ctx, item *T, errs frontend.FormErrors) error {
+	if h.resource.Views == nil {
+		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(errs)
+	}
+	return frontend.RenderForm(ctx, errs, h.resource.Views.Edit(item), h.admin.Layout)
+}
+
+func (h *resourceHandler[T]) saved(ctx *fiber.Ctx, item *T, status int) error {
+	if h.resource.Views == nil {
+		return ctx.Status(status).JSON(item)
+	}
+	pk := h.pk.Value(reflect.ValueOf(item).Elem()).Interface()
+	return frontend.Redirect(ctx, h.resource.Route.Path+"/"+url.PathEscape(fmt.Sprint(pk)))
+}
+
+func (h *resourceHandler[T]) parseListRequest(ctx *fiber.Ctx) (ListRequest, error) {
+	request := ListRequest{}
+	values := url.Values{}
+	ctx.Request().URI().QueryArgs().VisitAll(func(key, value []byte) {
+		values.Add(string(key), string(value))
+	})
+	decoder := formam.NewDecoder(&formam.DecoderOptions{TagName: "json", IgnoreUnknownKeys: true})
+	if err := decoder.Decode(values, &request); err != nil {
+		return request, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if request.Limit <= 0 {
+		request.Limit = h.resource.PageSize
+	}
+	request.Limit = min(request.Limit, h.resource.MaxPageSize)
+	if request.Offset < 0 {
+		request.Offset = 0
+	}
+	if request.Sort == "" {
+		request.Sort = h.resource.DefaultSort
+	}
+	if field, _ := parseSort(request.Sort); field != "" && !lo.Contains(h.resource.SortFields, field) {
+		return request, fiber.NewError(fiber.StatusBadRequest, "unsupported sort field: "+field)
+	}
+	return request, nil
+}
+
+func parseSort(sort string) (string, bool) {
+	if strings.HasPrefix(sort, "-") {
+		return sort[1:], true
+	}
+	return sort, false
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,224 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/iwrk-platform/formam/v3"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// HTMX request and response headers
+// https://htmx.org/reference/#headers
+const (
+	HXRequest               = "HX-Request"
+	HXBoosted               = "HX-Boosted"
+	HXTarget                = "HX-Target"
+	HXTriggerName           = "HX-Trigger-Name"
+	HXCurrentURL            = "HX-Current-URL"
+	HXHistoryRestoreRequest = "HX-History-Restore-Request"
+
+	HXTrigger            = "HX-Trigger"
+	HXTriggerAfterSettle = "HX-Trigger-After-Settle"
+	HXTriggerAfterSwap   = "HX-Trigger-After-Swap"
+	HXRedirect           = "HX-Redirect"
+	HXRefresh            = "HX-Refresh"
+	HXPushUrl            = "HX-Push-Url"
+	HXReplaceUrl         = "HX-Replace-Url"
+	HXRetarget           = "HX-Retarget"
+	HXReswap             = "HX-Reswap"
+)
+
+// FormErrorKey is the FormErrors key for errors not bound to a single field
+const FormErrorKey = "_form"
+
+// Component is the rendering contract of templ components (templ.Component)
+type Component interface {
+	Render(ctx context.Context, w io.Writer) error
+}
+
+// ComponentFunc adapts a plain function to Component
+type ComponentFunc func(ctx context.Context, w io.Writer) error
+
+func (f ComponentFunc) Render(ctx context.Context, w io.Writer) error {
+	return f(ctx, w)
+}
+
+// Layout wraps page content into the full page markup
+type Layout func(content Component) Component
+
+// FormErrors validation messages keyed by form field json name
+type FormErrors map[string]string
+
+func (fe FormErrors) Add(field, message string) {
+	fe[field] = message
+}
+
+func (fe FormErrors) Has(field string) bool {
+	_, ok := fe[field]
+	return ok
+}
+
+func (fe FormErrors) Get(field string) string {
+	return fe[field]
+}
+
+func (fe FormErrors) IsEmpty() bool {
+	return len(fe) == 0
+}
+
+// FormValidator is implemented by forms which check themselves after binding
+type FormValidator interface {
+	Validate(ctx context.Context) FormErrors
+}
+
+// IsHTMX reports whether the request was issued by htmx
+func IsHTMX(ctx *fiber.Ctx) bool {
+	return ctx.Get(HXRequest) == "true"
+}
+
+// IsBoosted reports whether the request came from an hx-boost element
+func IsBoosted(ctx *fiber.Ctx) bool {
+	return ctx.Get(HXBoosted) == "true"
+}
+
+// IsPartial reports whether only the page fragment must be rendered.
+// Boosted navigation and history restoration expect the full layout.
+func IsPartial(ctx *fiber.Ctx) bool {
+	return IsHTMX(ctx) && !IsBoosted(ctx) && ctx.Get(HXHistoryRestoreRequest) != "true"
+}
+
+// Render writes component as html, wrapped into layout unless the request is a partial htmx request
+func Render(ctx *fiber.Ctx, component Component, layout Layout) error {
+	ctx.Vary(HXRequest)
+	ctx.Type("html", "utf-8")
+	if layout != nil && !IsPartial(ctx) {
+		component = layout(component)
+	}
+	return component.Render(ctx.Context(), ctx.Response().BodyWriter())
+}
+
+// RenderForm re-renders form with the validation errors available through GetFormErrors.
+// Plain form posts get 422, htmx requests get 200 because htmx does not swap error responses.
+func RenderForm(ctx *fiber.Ctx, errs FormErrors, form Component, layout Layout) error {
+	ctx.Locals("formErrors", errs)
+	if !IsHTMX(ctx) && !errs.IsEmpty() {
+		ctx.Status(fiber.StatusUnprocessableEntity)
+	}
+	return Render(ctx, form, layout)
+}
+
+// GetFormErrors returns the errors set by RenderForm, used inside form templates
+func GetFormErrors(ctx context.Context) FormErrors {
+	if errs, ok := ctx.Value("formErrors").(FormErrors); ok {
+		return errs
+	}
+	return FormErrors{}
+}
+
+// BindForm decodes urlencoded or multipart form into item and validates it when item is a FormValidator
+func BindForm[T any](ctx *fiber.Ctx, item T) FormErrors {
+	errs := FormErrors{}
+	values, err := formValues(ctx)
+	if err != nil {
+		errs.Add(FormErrorKey, err.Error())
+		return errs
+	}
+	decoder := formam.NewDecoder(&formam.DecoderOptions{TagName: "json", IgnoreUnknownKeys: true})
+	if err = decoder.Decode(values, item); err != nil {
+		var formErr *formam.Error
+		if errors.As(err, &formErr) && formErr.Path() != "" {
+			errs.Add(formErr.Path(), formErr.Cause().Error())
+		} else {
+			errs.Add(FormErrorKey, err.Error())
+		}
+		return errs
+	}
+	if validator, ok := any(item).(FormValidator); ok {
+		for field, message := range validator.Validate(ctx.Context()) {
+			errs.Add(field, message)
+		}
+	}
+	return errs
+}
+
+func formValues(ctx *fiber.Ctx) (url.Values, error) {
+	if strings.HasPrefix(string(ctx.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		mpd, err := ctx.MultipartForm()
+		if err != nil {
+			return nil, err
+		}
+		return mpd.Value, nil
+	}
+	values := url.Values{}
+	ctx.Request().PostArgs().VisitAll(func(key, value []byte) {
+		values.Add(string(key), string(value))
+	})
+	return values, nil
+}
+
+// Trigger sets HX-Trigger with events without details
+func Trigger(ctx *fiber.Ctx, events ...string) {
+	ctx.Set(HXTrigger, strings.Join(events, ", "))
+}
+
+// TriggerEvent sets HX-Trigger with a single event carrying detail as json
+func TriggerEvent(ctx *fiber.Ctx, event string, detail any) error {
+	return triggerEvent(ctx, HXTrigger, event, detail)
+}
+
+// TriggerAfterSettle sets HX-Trigger-After-Settle with a single event carrying detail as json
+func TriggerAfterSettle(ctx *fiber.Ctx, event string, detail any) error {
+	return triggerEvent(ctx, HXTriggerAfterSettle, event, detail)
+}
+
+// TriggerAfterSwap sets HX-Trigger-After-Swap with a single event carrying detail as json
+func TriggerAfterSwap(ctx *fiber.Ctx, event string, detail any) error {
+	return triggerEvent(ctx, HXTriggerAfterSwap, event, detail)
+}
+
+func triggerEvent(ctx *fiber.Ctx, header, event string, detail any) error {
+	payload, err := json.Marshal(map[string]any{event: detail})
+	if err != nil {
+		return err
+	}
+	ctx.Set(header, string(payload))
+	return nil
+}
+
+// Redirect sends HX-Redirect to htmx requests and a regular 303 redirect otherwise
+func Redirect(ctx *fiber.Ctx, location string) error {
+	if IsHTMX(ctx) {
+		ctx.Set(HXRedirect, location)
+		return ctx.SendStatus(fiber.StatusOK)
+	}
+	return ctx.Redirect(location, fiber.StatusSeeOther)
+}
+
+// Refresh asks htmx to do a full page reload
+func Refresh(ctx *fiber.Ctx) {
+	ctx.Set(HXRefresh, "true")
+}
+
+// PushUrl pushes location into the browser history
+func PushUrl(ctx *fiber.Ctx, location string) {
+	ctx.Set(HXPushUrl, location)
+}
+
+// ReplaceUrl replaces the current location in the browser history
+func ReplaceUrl(ctx *fiber.Ctx, location string) {
+	ctx.Set(HXReplaceUrl, location)
+}
+
+// Retarget overrides the hx-target of the request with css selector
+func Retarget(ctx *fiber.Ctx, selector string) {
+	ctx.Set(HXRetarget, selector)
+}
+
+// Reswap overrides the hx-swap of the request
+func Reswap(ctx *fiber.Ctx, swap string) {
+	ctx.Set(HXReswap, swap)
+}
@@ -1,6 +1,9 @@
 package frontend
 
-import "strings"
+import (
+	"github.com/samber/lo"
+	"strings"
+)
 
 type MenuRoute struct {
 	Title        string
@@ -18,3 +21,26 @@ func IsActiveItemElement(itemPath, currentPath string, isBase bool) bool {
 
 	return strings.HasPrefix(currentPath, itemPath)
 }
+
+// IsAllowedRoute checks user roles against route AllowedRoles, route without AllowedRoles is public
+func IsAllowedRoute(route MenuRoute, roles []string) bool {
+	if len(route.AllowedRoles) == 0 {
+		return true
+	}
+	return lo.Some(route.AllowedRoles, roles)
+}
+
+// FilterMenuRoutes returns routes and nested items visible for user roles
+func FilterMenuRoutes(routes []MenuRoute, roles []string) []MenuRoute {
+	allowed := make([]MenuRoute, 0, len(routes))
+	for _, route := range routes {
+		if !IsAllowedRoute(route, roles) {
+			continue
+		}
+		if len(route.Items) > 0 {
+			route.Items = FilterMenuRoutes(route.Items, roles)
+		}
+		allowed = append(allowed, route)
+	}
+	return allowed
+}
@@ -0,0 +1,243 @@
+package marina
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+const (
+	defaultBatchRows   = 1000
+	defaultBatchBytes  = 4 << 20
+	defaultConcurrency = 4
+)
+
+// ModelIterator yields models until yield returns false, the shape of iter.Seq[any]
+type ModelIterator func(yield func(model any) bool)
+
+// BulkIndexerOptions options of BulkIndexer
+type BulkIndexerOptions struct {
+	Index string
+	// Upsert replaces existing documents, inserts fail on duplicate ids otherwise
+	Upsert bool
+	// BatchRows maximum models in a batch, 1000 by default
+	BatchRows int
+	// BatchBytes maximum statement size, 4MB by default, keep it below searchd max_packet_size
+	BatchBytes int
+	// Concurrency number of batches executed at once, 4 by default
+	Concurrency int
+	// OnError is called for every failed batch, it may be called from several goroutines at once
+	OnError func(err *BatchError)
+}
+
+// BatchError failure of a batch, Offset is the stream position of its first model
+type BatchError struct {
+	Batch  int
+	Offset int
+	Count  int
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch %d (models %d-%d): %v", e.Batch, e.Offset, e.Offset+e.Count-1, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BulkIndexResult totals of a bulk indexer run
+type BulkIndexResult struct {
+	Indexed int64
+	Batches int
+	Failed  []*BatchError
+}
+
+// Err joins batch failures, nil when all batches succeeded
+func (r *BulkIndexResult) Err() error {
+	errs := make([]error, 0, len(r.Failed))
+	for _, failed := range r.Failed {
+		errs = append(errs, failed)
+	}
+	return errors.Join(errs...)
+}
+
+// BulkIndexer splits a stream of models into batches by row count and statement size and
+// executes them concurrently. A failed batch does not stop the others, see BulkIndexResult.Failed.
+// OPTIMIZE is not run, schedule Optimize separately after large loads.
+type BulkIndexer struct {
+	options BulkIndexerOptions
+	exec    func(ctx context.Context, statement string) error
+}
+
+type indexBatch struct {
+	number int
+	offset int
+	rows   []string
+}
+
+// NewBulkIndexer method initialize new bulk indexer
+func (m *marinaClient) NewBulkIndexer(options BulkIndexerOptions) *BulkIndexer {
+	if options.BatchRows <= 0 {
+		options.BatchRows = defaultBatchRows
+	}
+	if options.BatchBytes <= 0 {
+		options.BatchBytes = defaultBatchBytes
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultConcurrency
+	}
+	return &BulkIndexer{
+		options: options,
+		exec: func(ctx context.Context, statement string) error {
+			_, err := m.Conn.ExecContext(ctx, statement)
+			return err
+		},
+	}
+}
+
+// RunIterator indexes models of the iterator
+func (bi *BulkIndexer) RunIterator(ctx context.Context, models ModelIterator) (*BulkIndexResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+		models(func(model any) bool {
+			select {
+			case ch <- model:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return bi.Run(ctx, ch)
+}
+
+// Run indexes models of the channel until it is closed, the error is returned when ctx is done
+// or the index is invalid, batch failures are reported in the result
+func (bi *BulkIndexer) Run(ctx context.Context, models <-chan any) (*BulkIndexResult, error) {
+	if _, err := QuoteIdentifier(bi.options.Index); err != nil {
+		return nil, err
+	}
+	queryType := BulkInsertQuery
+	if bi.options.Upsert {
+		queryType = BulkUpsertQuery
+	}
+
+	result := &BulkIndexResult{}
+	var mu sync.Mutex
+	fail := func(err *BatchError) {
+		mu.Lock()
+		result.Failed = append(result.Failed, err)
+		mu.Unlock()
+		if bi.options.OnError != nil {
+			bi.options.OnError(err)
+		}
+	}
+
+	var (
+		columns   []string
+		fields    []string
+		modelType reflect.Type
+	)
+	batches := make(chan indexBatch)
+	var wg sync.WaitGroup
+	for i := 0; i < bi.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				statement := bulkStatement(queryType, bi.options.Index, columns, batch.rows)
+				if err := bi.exec(ctx, statement); err != nil {
+					fail(&BatchError{Batch: batch.number, Offset: batch.offset, Count: len(batch.rows), Err: err})
+					continue
+				}
+				mu.Lock()
+				result.Indexed += int64(len(batch.rows))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	current := indexBatch{}
+	size := 0
+	flush := func() bool {
+		if len(current.rows) == 0 {
+			return true
+		}
+		select {
+		case batches <- current:
+		case <-ctx.Done():
+			return false
+		}
+		result.Batches++
+		current = indexBatch{number: current.number + 1}
+		size = 0
+		return true
+	}
+
+	offset := 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case model, ok := <-models:
+			if !ok {
+				flush()
+				break loop
+			}
+			if modelType == nil {
+				var err error
+				if fields, err = getFieldNames(model); err != nil {
+					close(batches)
+					wg.Wait()
+					return result, err
+				}
+				modelType = reflect.TypeOf(model)
+				columns = modelColumns(model, fields)
+			}
+			row, err := bi.row(model, modelType, fields)
+			if err != nil {
+				fail(&BatchError{Batch: current.number, Offset: offset, Count: 1, Err: err})
+				offset++
+				continue
+			}
+			// the statement prefix and the row separator are not counted, batches stay a bit below BatchBytes
+			if len(current.rows) > 0 && (len(current.rows) >= bi.options.BatchRows || size+len(row) > bi.options.BatchBytes) {
+				if !flush() {
+					break loop
+				}
+			}
+			if len(current.rows) == 0 {
+				current.offset = offset
+			}
+			current.rows = append(current.rows, row)
+			size += len(row)
+			offset++
+		}
+	}
+	close(batches)
+	wg.Wait()
+	return result, ctx.Err()
+}
+
+func (bi *BulkIndexer) row(model any, modelType reflect.Type, fields []string) (string, error) {
+	if reflect.TypeOf(model) != modelType {
+		return "", fmt.Errorf("model %T differs from %s of the stream", model, modelType)
+	}
+	return modelRow(model, fields)
+}
+
+// Optimize merges disk chunks of the index, run it after large loads rather than after every write
+func (m *marinaClient) Optimize(ctx context.Context, index string) error {
+	if _, err := QuoteIdentifier(index); err != nil {
+		return err
+	}
+	_, err := m.Conn.ExecContext(ctx, "OPTIMIZE INDEX "+index)
+	return err
+}
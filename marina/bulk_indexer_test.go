@@ -0,0 +1,102 @@
+package marina
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type bulkProduct struct {
+	ID    int64
+	Title string
+}
+
+func TestBulkIndexerRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     BulkIndexerOptions
+		models      []any
+		failing     string
+		wantBatches int
+		wantIndexed int64
+		wantFailed  []int
+	}{
+		{
+			name:        "rows",
+			options:     BulkIndexerOptions{Index: "products", BatchRows: 2},
+			models:      []any{bulkProduct{ID: 1}, bulkProduct{ID: 2}, bulkProduct{ID: 3}},
+			wantBatches: 2,
+			wantIndexed: 3,
+		},
+		{
+			name:        "bytes",
+			options:     BulkIndexerOptions{Index: "products", BatchBytes: 10},
+			models:      []any{bulkProduct{ID: 1, Title: "a"}, bulkProduct{ID: 2, Title: "b"}, bulkProduct{ID: 3, Title: "c"}},
+			wantBatches: 3,
+			wantIndexed: 3,
+		},
+		{
+			name:        "failed batch",
+			options:     BulkIndexerOptions{Index: "products", BatchRows: 1},
+			models:      []any{bulkProduct{ID: 1}, bulkProduct{ID: 2, Title: "bad"}, bulkProduct{ID: 3}},
+			failing:     "bad",
+			wantBatches: 3,
+			wantIndexed: 2,
+			wantFailed:  []int{1},
+		},
+		{
+			name:        "mixed models",
+			options:     BulkIndexerOptions{Index: "products"},
+			models:      []any{bulkProduct{ID: 1}, scanProduct{ID: 2}, bulkProduct{ID: 3}},
+			wantBatches: 1,
+			wantIndexed: 2,
+			wantFailed:  []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			statements := make([]string, 0)
+			bi := (&marinaClient{}).NewBulkIndexer(tt.options)
+			bi.exec = func(ctx context.Context, statement string) error {
+				if tt.failing != "" && strings.Contains(statement, tt.failing) {
+					return errors.New("syntax error")
+				}
+				mu.Lock()
+				statements = append(statements, statement)
+				mu.Unlock()
+				return nil
+			}
+			result, err := bi.RunIterator(context.Background(), func(yield func(any) bool) {
+				for _, model := range tt.models {
+					if !yield(model) {
+						return
+					}
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Batches != tt.wantBatches || result.Indexed != tt.wantIndexed {
+				t.Errorf("Run() batches = %d, indexed = %d, want %d, %d", result.Batches, result.Indexed, tt.wantBatches, tt.wantIndexed)
+			}
+			offsets := make([]int, 0)
+			for _, failed := range result.Failed {
+				offsets = append(offsets, failed.Offset)
+			}
+			if len(offsets) != len(tt.wantFailed) || (len(offsets) > 0 && offsets[0] != tt.wantFailed[0]) {
+				t.Errorf("Run() failed offsets = %v, want %v", offsets, tt.wantFailed)
+			}
+			if (result.Err() != nil) != (len(tt.wantFailed) > 0) {
+				t.Errorf("Err() = %v", result.Err())
+			}
+			for _, statement := range statements {
+				if !strings.HasPrefix(statement, "INSERT INTO products(id, title) VALUES(") {
+					t.Errorf("unexpected statement %s", statement)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package marina
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
@@ -10,10 +11,17 @@ type MarinaClient interface {
 	NewInsert() *Query
 	NewUpsert() *Query
 	NewDelete() *Query
+	NewUpdate() *Query
 	NewCreate() *IndexQuery
 	NewDrop() *IndexQuery
 	NewBulkInsert() *BulkQuery
 	NewBulkUpsert() *BulkQuery
+	SyncSchema(ctx context.Context, index string, schema *Schema, options SchemaSyncOptions) (*SchemaDiff, error)
+	Reindex(ctx context.Context, reindex Reindex) (*ReindexResult, error)
+	ResolveIndex(ctx context.Context, alias string) (string, error)
+	NewBulkIndexer(options BulkIndexerOptions) *BulkIndexer
+	Optimize(ctx context.Context, index string) error
+	Transaction(ctx context.Context, fn func(tx *Tx) error) error
 }
 
 type Facet struct {
@@ -24,11 +32,15 @@ type Facet struct {
 type FacetItem struct {
 	Variant string
 	Value   int64
+	// From and To bounds of range facet bucket, nil for open ends
+	From *float64
+	To   *float64
 }
 
 type SearchResult struct {
 	Ids   []uint32
 	Count int64
+	Meta  Meta
 }
 
 type CountResult struct {
@@ -36,9 +48,11 @@ type CountResult struct {
 }
 
 type SearchWithFacetResult struct {
-	Ids    []uint32
-	Total  int64
-	Facets []*Facet
+	Ids     []uint32
+	Total   int64
+	Facets  []*Facet
+	Buckets FacetResult
+	Meta    Meta
 }
 
 type marinaClient struct {
@@ -53,47 +67,32 @@ func (m *marinaClient) Close() error {
 // NewSearch method initialize new search request
 func (m *marinaClient) NewSearch() *SearchQuery {
 	return &SearchQuery{
-		conn:        m.Conn,
-		where:       make([][]byte, 0),
-		whereOr:     make([][]byte, 0),
-		order:       make([][]byte, 0),
-		facet:       make([][]byte, 0),
-		match:       make([][]byte, 0),
-		facetFields: make([]string, 0),
+		conn:    m.Conn,
+		where:   make([]Filter, 0),
+		whereOr: make([]Filter, 0),
+		order:   make([][]byte, 0),
+		facets:  make([]FacetOptions, 0),
 	}
 }
 
 // NewInsert method initialize new insert request
 func (m *marinaClient) NewInsert() *Query {
-	return &Query{
-		queryType: InsertQuery,
-		conn:      m.Conn,
-		fields:    make([]string, 0),
-		where:     make([][]byte, 0),
-		query:     make([]string, 0),
-	}
+	return newQuery(m.Conn, InsertQuery)
 }
 
 // NewUpsert method initialize new upsert request
 func (m *marinaClient) NewUpsert() *Query {
-	return &Query{
-		queryType: UpsertQuery,
-		conn:      m.Conn,
-		fields:    make([]string, 0),
-		where:     make([][]byte, 0),
-		query:     make([]string, 0),
-	}
+	return newQuery(m.Conn, UpsertQuery)
 }
 
 // NewDelete method initialize new delete request
 func (m *marinaClient) NewDelete() *Query {
-	return &Query{
-		queryType: DeleteQuery,
-		conn:      m.Conn,
-		fields:    make([]string, 0),
-		where:     make([][]byte, 0),
-		query:     make([]string, 0),
-	}
+	return newQuery(m.Conn, DeleteQuery)
+}
+
+// NewUpdate method initialize new update request, only attribute columns can be updated
+func (m *marinaClient) NewUpdate() *Query {
+	return newQuery(m.Conn, UpdateQuery)
 }
 
 // NewCreate method initialize new create index request
@@ -101,7 +100,6 @@ func (m *marinaClient) NewCreate() *IndexQuery {
 	return &IndexQuery{
 		conn:      m.Conn,
 		queryType: CreateQuery,
-		fields:    make([][]byte, 0),
 	}
 }
 
@@ -110,26 +108,15 @@ func (m *marinaClient) NewDrop() *IndexQuery {
 	return &IndexQuery{
 		conn:      m.Conn,
 		queryType: DropQuery,
-		fields:    make([][]byte, 0),
 	}
 }
 
 // NewBulkInsert method initialize new bulk insert request
 func (m *marinaClient) NewBulkInsert() *BulkQuery {
-	return &BulkQuery{
-		queryType: BulkInsertQuery,
-		conn:      m.Conn,
-		fields:    make([]string, 0),
-		query:     make([]string, 0),
-	}
+	return newBulkQuery(m.Conn, BulkInsertQuery)
 }
 
 // NewBulkUpsert method initialize new bulk upsert request
 func (m *marinaClient) NewBulkUpsert() *BulkQuery {
-	return &BulkQuery{
-		queryType: BulkUpsertQuery,
-		conn:      m.Conn,
-		fields:    make([]string, 0),
-		query:     make([]string, 0),
-	}
+	return newBulkQuery(m.Conn, BulkUpsertQuery)
 }
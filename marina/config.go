@@ -2,7 +2,9 @@ package marina
 
 import (
 	"fmt"
+	"github.com/go-sql-driver/mysql"
 	"go.uber.org/config"
+	"net"
 )
 
 type Config struct {
@@ -21,3 +23,18 @@ func NewMarinaConfig(provider config.Provider) (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// DSN returns connection string, multi-statements are enabled for searches with SHOW META
+func (c *Config) DSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = c.Host
+	if c.Port != "" {
+		cfg.Addr = net.JoinHostPort(c.Host, c.Port)
+	}
+	cfg.DBName = c.Database
+	cfg.MultiStatements = true
+	return cfg.FormatDSN()
+}
@@ -0,0 +1,172 @@
+package marina
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var identifierRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+var stringEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	"\x00", `\0`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x1a", `\Z`,
+)
+
+// matchEscaper escapes full-text query operators so user text is searched literally
+var matchEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`!`, `\!`,
+	`"`, `\"`,
+	`$`, `\$`,
+	`'`, `\'`,
+	`(`, `\(`,
+	`)`, `\)`,
+	`-`, `\-`,
+	`/`, `\/`,
+	`<`, `\<`,
+	`@`, `\@`,
+	`^`, `\^`,
+	`|`, `\|`,
+	`~`, `\~`,
+	`=`, `\=`,
+	`*`, `\*`,
+	`?`, `\?`,
+	`%`, `\%`,
+	`&`, `\&`,
+)
+
+// QuoteString returns s as a Manticore SQL string literal
+func QuoteString(s string) string {
+	return "'" + stringEscaper.Replace(s) + "'"
+}
+
+// EscapeMatch escapes full-text operators of s, the result is used inside MATCH after QuoteString
+func EscapeMatch(s string) string {
+	return matchEscaper.Replace(s)
+}
+
+// QuoteIdentifier validates index, field or JSON attribute path name and quotes simple names,
+// so reserved words like `order` can be used as field names
+func QuoteIdentifier(name string) (string, error) {
+	if !identifierRE.MatchString(name) {
+		return "", fmt.Errorf("invalid identifier %q", name)
+	}
+	if strings.Contains(name, ".") {
+		return name, nil
+	}
+	return "`" + name + "`", nil
+}
+
+// formatArg renders placeholder argument as SQL: strings are quoted, time.Time is a unix timestamp,
+// slices are parenthesized lists for IN and MVA values, nil is NULL
+func formatArg(arg any) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return QuoteString(v), nil
+	case []byte:
+		return QuoteString(string(v)), nil
+	case time.Time:
+		return strconv.FormatInt(v.Unix(), 10), nil
+	case *time.Time:
+		if v == nil {
+			return "NULL", nil
+		}
+		return strconv.FormatInt(v.Unix(), 10), nil
+	}
+
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return "NULL", nil
+		}
+		return formatArg(rv.Elem().Interface())
+	case reflect.String:
+		return QuoteString(rv.String()), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return "true", nil
+		}
+		return "false", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return formatFloat(rv.Float(), 32)
+	case reflect.Float64:
+		return formatFloat(rv.Float(), 64)
+	case reflect.Slice, reflect.Array:
+		elements := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			element := rv.Index(i)
+			if element.Kind() == reflect.Slice && element.Type().Elem().Kind() != reflect.Uint8 {
+				return "", errors.New("nested slices are not supported")
+			}
+			value, err := formatArg(element.Interface())
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, value)
+		}
+		return "(" + strings.Join(elements, ",") + ")", nil
+	default:
+		return "", fmt.Errorf("query have unsupported argument type %T", arg)
+	}
+}
+
+func formatFloat(f float64, bitSize int) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("unsupported float value %v", f)
+	}
+	return strconv.FormatFloat(f, 'f', -1, bitSize), nil
+}
+
+// replacePlaceholders replaces ? outside of string literals of query with formatted args
+func replacePlaceholders(query string, args []any) (string, error) {
+	sb := strings.Builder{}
+	sb.Grow(len(query))
+	n := 0
+	var quote rune
+	escaped := false
+	for _, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		case quote == 0 && r == '?':
+			if n >= len(args) {
+				return "", errors.New("wrong number of arguments")
+			}
+			value, err := formatArg(args[n])
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			n++
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	if n != len(args) {
+		return "", errors.New("wrong number of arguments")
+	}
+	return sb.String(), nil
+}
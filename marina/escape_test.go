@@ -0,0 +1,189 @@
+package marina
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "empty", value: "", want: `''`},
+		{name: "plain", value: "hello world", want: `'hello world'`},
+		{name: "email", value: "john.doe+test@example.com", want: `'john.doe+test@example.com'`},
+		{name: "sku", value: "AB-12/3_X", want: `'AB-12/3_X'`},
+		{name: "single quote", value: "O'Brien", want: `'O\'Brien'`},
+		{name: "double quote", value: `say "hi"`, want: `'say "hi"'`},
+		{name: "backslash", value: `C:\path\`, want: `'C:\\path\\'`},
+		{name: "escaped quote", value: `\'`, want: `'\\\''`},
+		{name: "injection", value: "'; DROP TABLE users; --", want: `'\'; DROP TABLE users; --'`},
+		{name: "control characters", value: "a\nb\rc\x00d\x1a", want: `'a\nb\rc\0d\Z'`},
+		{name: "unicode", value: "Привет, мир №5", want: `'Привет, мир №5'`},
+		{name: "html", value: "<b>bold</b>", want: `'<b>bold</b>'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuoteString(tt.value); got != tt.want {
+				t.Errorf("QuoteString() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "laptop", want: "laptop"},
+		{name: "hyphenated", value: "e-mail", want: `e\-mail`},
+		{name: "email", value: "john@example.com", want: `john\@example.com`},
+		{name: "sku", value: "AB-12/3", want: `AB\-12\/3`},
+		{name: "operators", value: `!"$'()-/<@^|~=*?%&`, want: `\!\"\$\'\(\)\-\/\<\@\^\|\~\=\*\?\%\&`},
+		{name: "backslash", value: `a\b`, want: `a\\b`},
+		{name: "unicode", value: "кофе-машина", want: `кофе\-машина`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeMatch(tt.value); got != tt.want {
+				t.Errorf("EscapeMatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "field", value: "title", want: "`title`"},
+		{name: "reserved word", value: "order", want: "`order`"},
+		{name: "json path", value: "meta.color", want: "meta.color"},
+		{name: "underscore", value: "_created_at2", want: "`_created_at2`"},
+		{name: "empty", value: "", wantErr: true},
+		{name: "digit first", value: "1field", wantErr: true},
+		{name: "backtick", value: "a`b", wantErr: true},
+		{name: "injection", value: "id; DROP TABLE x", wantErr: true},
+		{name: "dangling dot", value: "meta.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QuoteIdentifier(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QuoteIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("QuoteIdentifier() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type status int
+
+func TestFormatArg(t *testing.T) {
+	id := int64(7)
+	var nilID *int64
+	tests := []struct {
+		name    string
+		arg     any
+		want    string
+		wantErr bool
+	}{
+		{name: "nil", arg: nil, want: "NULL"},
+		{name: "nil pointer", arg: nilID, want: "NULL"},
+		{name: "pointer", arg: &id, want: "7"},
+		{name: "string", arg: "it's", want: `'it\'s'`},
+		{name: "bytes", arg: []byte("raw"), want: `'raw'`},
+		{name: "bool", arg: true, want: "true"},
+		{name: "int", arg: -42, want: "-42"},
+		{name: "uint64", arg: uint64(math.MaxUint64), want: "18446744073709551615"},
+		{name: "named int", arg: status(3), want: "3"},
+		{name: "float32", arg: float32(0.1), want: "0.1"},
+		{name: "float64", arg: 1.5e-7, want: "0.00000015"},
+		{name: "nan", arg: math.NaN(), wantErr: true},
+		{name: "inf", arg: math.Inf(1), wantErr: true},
+		{name: "time", arg: time.Unix(1700000000, 0), want: "1700000000"},
+		{name: "int slice", arg: []int{1, 2, 3}, want: "(1,2,3)"},
+		{name: "uint32 slice", arg: []uint32{4, 5}, want: "(4,5)"},
+		{name: "string slice", arg: []string{"a'b", "c"}, want: `('a\'b','c')`},
+		{name: "empty slice", arg: []int64{}, want: "()"},
+		{name: "nested slice", arg: [][]int{{1}}, wantErr: true},
+		{name: "struct", arg: struct{}{}, wantErr: true},
+		{name: "map", arg: map[string]int{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatArg(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("formatArg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("formatArg() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		args    []any
+		want    string
+		wantErr bool
+	}{
+		{name: "no placeholders", query: "id > 1", want: "id > 1"},
+		{name: "no space before placeholder", query: "id=?", args: []any{5}, want: "id=5"},
+		{name: "several", query: "a = ? AND b IN ?", args: []any{"x", []int{1, 2}}, want: "a = 'x' AND b IN (1,2)"},
+		{name: "placeholder at start", query: "? = id", args: []any{1}, want: "1 = id"},
+		{name: "question mark in literal", query: "title = 'what?' AND id = ?", args: []any{3}, want: "title = 'what?' AND id = 3"},
+		{name: "escaped quote in literal", query: `title = 'it\'s ?' AND id = ?`, args: []any{3}, want: `title = 'it\'s ?' AND id = 3`},
+		{name: "argument with question mark", query: "a = ? AND b = ?", args: []any{"?", "x"}, want: "a = '?' AND b = 'x'"},
+		{name: "unicode before placeholder", query: "имя=?", args: []any{"Ёж"}, want: "имя='Ёж'"},
+		{name: "too few arguments", query: "a = ? AND b = ?", args: []any{1}, wantErr: true},
+		{name: "too many arguments", query: "a = ?", args: []any{1, 2}, wantErr: true},
+		{name: "unsupported argument", query: "a = ?", args: []any{struct{}{}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replacePlaceholders(tt.query, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("replacePlaceholders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("replacePlaceholders() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "  ", want: ""},
+		{name: "short word", query: "tv", want: `^tv*`},
+		{name: "word", query: "laptop", want: `laptop*`},
+		{name: "hyphenated", query: "e-mail", want: `e\-mail*`},
+		{name: "quote", query: "O'Brien", want: `O\'Brien*`},
+		{name: "words", query: "red  AB-12", want: `"*red* *AB\-12*"/1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchExpression(tt.query); got != tt.want {
+				t.Errorf("matchExpression() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
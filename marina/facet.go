@@ -0,0 +1,176 @@
+package marina
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const facetCountColumn = "count(*)"
+
+// FacetOptions FACET clause, every facet returns its own result set of buckets
+type FacetOptions struct {
+	// Name result key, Field by default
+	Name string
+	// Field attribute to facet by, multi-value attributes give a bucket per value
+	Field string
+	// By groups buckets by expression while Field is returned, e.g. Field brand_name By brand_id
+	By string
+	// Order ORDER BY of buckets, e.g. FACET() DESC or brand_name ASC
+	Order string
+	// Limit maximum number of buckets, Manticore returns 20 by default
+	Limit int
+	// Ranges bounds of numeric buckets: < Ranges[0], [Ranges[0], Ranges[1]), ..., >= Ranges[n-1]
+	Ranges []float64
+}
+
+func (o FacetOptions) name() string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.Field
+}
+
+func (o FacetOptions) sql() (string, error) {
+	field, err := QuoteIdentifier(o.Field)
+	if err != nil {
+		return "", err
+	}
+	sb := bytes.NewBufferString(" FACET ")
+	if len(o.Ranges) > 0 {
+		bounds := make([]string, 0, len(o.Ranges))
+		for i, bound := range o.Ranges {
+			if i > 0 && bound <= o.Ranges[i-1] {
+				return "", fmt.Errorf("facet %s ranges must be ascending", o.name())
+			}
+			value, err := formatFloat(bound, 64)
+			if err != nil {
+				return "", err
+			}
+			bounds = append(bounds, value)
+		}
+		sb.WriteString("INTERVAL(" + field + "," + strings.Join(bounds, ",") + ") AS _range_" + strings.ReplaceAll(o.Field, ".", "_"))
+	} else {
+		sb.WriteString(field)
+	}
+	if o.By != "" {
+		sb.WriteString(" BY " + o.By)
+	}
+	if o.Order != "" {
+		sb.WriteString(" ORDER BY " + o.Order)
+	}
+	if o.Limit > 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(o.Limit))
+	}
+	return sb.String(), nil
+}
+
+// bucket returns label and bounds of INTERVAL bucket index
+func (o FacetOptions) bucket(index int) (string, *float64, *float64) {
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	switch {
+	case index <= 0:
+		to := o.Ranges[0]
+		return "<" + format(to), nil, &to
+	case index >= len(o.Ranges):
+		from := o.Ranges[len(o.Ranges)-1]
+		return ">=" + format(from), &from, nil
+	}
+	from, to := o.Ranges[index-1], o.Ranges[index]
+	return format(from) + "-" + format(to), &from, &to
+}
+
+// FacetResult ordered buckets by facet name
+type FacetResult map[string][]*FacetItem
+
+// FacetWith adds facet with options
+func (sq *SearchQuery) FacetWith(options FacetOptions) *SearchQuery {
+	if options.Field == "" {
+		sq.err = errors.New("facet field is empty")
+		return sq
+	}
+	sq.facets = append(sq.facets, options)
+	return sq
+}
+
+// facetSQL renders FACET clauses in the order of result sets
+func (sq *SearchQuery) facetSQL() (string, error) {
+	sb := strings.Builder{}
+	for _, facet := range sq.facets {
+		clause, err := facet.sql()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(clause)
+	}
+	return sb.String(), nil
+}
+
+// getFacets reads a result set per facet, the first column is the bucket value
+func getFacets(rows *sql.Rows, facets []FacetOptions) ([]*Facet, error) {
+	result := make([]*Facet, 0, len(facets))
+	for _, options := range facets {
+		if !rows.NextResultSet() {
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("facet %s: no result set", options.name())
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		count := -1
+		for i, column := range columns {
+			if strings.EqualFold(column, facetCountColumn) {
+				count = i
+			}
+		}
+		if len(columns) < 2 || count < 0 {
+			return nil, fmt.Errorf("facet %s: unexpected columns %v", options.name(), columns)
+		}
+
+		facet := &Facet{FilterName: options.name(), Data: make([]*FacetItem, 0)}
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if err = rows.Scan(dest...); err != nil {
+				return nil, err
+			}
+			item := &FacetItem{Variant: string(values[0])}
+			if item.Value, err = strconv.ParseInt(string(values[count]), 10, 64); err != nil {
+				return nil, fmt.Errorf("facet %s count: %w", options.name(), err)
+			}
+			if len(options.Ranges) > 0 {
+				index, err := strconv.Atoi(item.Variant)
+				if err != nil {
+					return nil, fmt.Errorf("facet %s interval: %w", options.name(), err)
+				}
+				item.Variant, item.From, item.To = options.bucket(index)
+			}
+			facet.Data = append(facet.Data, item)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		result = append(result, facet)
+	}
+	return result, nil
+}
+
+// facetResult maps facets by name
+func facetResult(facets []*Facet) FacetResult {
+	result := make(FacetResult, len(facets))
+	for _, facet := range facets {
+		result[facet.FilterName] = facet.Data
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package marina
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"testing"
+)
+
+func TestFacetSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		facet   FacetOptions
+		want    string
+		wantErr bool
+	}{
+		{name: "field", facet: FacetOptions{Field: "brand_id"}, want: " FACET `brand_id`"},
+		{
+			name:  "options",
+			facet: FacetOptions{Field: "brand_name", By: "brand_id", Order: "FACET() DESC", Limit: 5},
+			want:  " FACET `brand_name` BY brand_id ORDER BY FACET() DESC LIMIT 5",
+		},
+		{
+			name:  "ranges",
+			facet: FacetOptions{Name: "price", Field: "price", Ranges: []float64{100, 500.5}},
+			want:  " FACET INTERVAL(`price`,100,500.5) AS _range_price",
+		},
+		{name: "unordered ranges", facet: FacetOptions{Field: "price", Ranges: []float64{5, 1}}, wantErr: true},
+		{name: "invalid field", facet: FacetOptions{Field: "price;"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.facet.sql()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sql() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sql() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFacetBucket(t *testing.T) {
+	facet := FacetOptions{Field: "price", Ranges: []float64{100, 500}}
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{index: 0, want: "<100"},
+		{index: 1, want: "100-500"},
+		{index: 2, want: ">=500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, from, to := facet.bucket(tt.index)
+			if got != tt.want {
+				t.Errorf("bucket() = %s, want %s", got, tt.want)
+			}
+			if (from == nil) != (tt.index == 0) || (to == nil) != (tt.index == 2) {
+				t.Errorf("bucket() bounds = %v, %v", from, to)
+			}
+		})
+	}
+}
+
+func TestSearchScanWithFacet(t *testing.T) {
+	connector := &fakeConnector{results: func(query string) []fakeResult {
+		return []fakeResult{
+			{columns: []string{"id"}, rows: [][]string{{"1"}, {"2"}}},
+			{columns: []string{"brand_id", "count(*)"}, rows: [][]string{{"7", "2"}}},
+			{columns: []string{"Variable_name", "Value"}, rows: [][]string{{"total", "2"}, {"total_found", "12"}}},
+		}
+	}}
+	m := &marinaClient{Conn: sqlx.NewDb(sql.OpenDB(connector), "mysql")}
+	defer m.Close()
+	result, err := m.NewSearch().Index("products").Facet("brand_id").Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Ids, []uint32{1, 2}) || result.Count != 12 {
+		t.Errorf("Scan() ids = %v, count = %d, want [1 2], 12", result.Ids, result.Count)
+	}
+}
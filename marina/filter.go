@@ -0,0 +1,488 @@
+package marina
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Filter node of a WHERE expression tree
+type Filter interface {
+	// SQL renders the filter, composite filters are parenthesized
+	SQL() (string, error)
+	// negate returns the opposite filter, Manticore has no general NOT, so negation is pushed down to leaves
+	negate() Filter
+}
+
+type logicalFilter struct {
+	op      string
+	filters []Filter
+}
+
+// And matches documents matching all filters, nil filters are skipped
+func And(filters ...Filter) Filter {
+	return newLogical("AND", filters)
+}
+
+// Or matches documents matching any of filters, nil filters are skipped
+func Or(filters ...Filter) Filter {
+	return newLogical("OR", filters)
+}
+
+func newLogical(op string, filters []Filter) Filter {
+	flat := make([]Filter, 0, len(filters))
+	for _, filter := range filters {
+		if filter == nil {
+			continue
+		}
+		// (a AND b) AND c is a AND b AND c
+		if logical, ok := filter.(*logicalFilter); ok && logical.op == op {
+			flat = append(flat, logical.filters...)
+			continue
+		}
+		flat = append(flat, filter)
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		return flat[0]
+	}
+	return &logicalFilter{op: op, filters: flat}
+}
+
+func (f *logicalFilter) SQL() (string, error) {
+	parts := make([]string, 0, len(f.filters))
+	for _, filter := range f.filters {
+		part, err := filter.SQL()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return "(" + strings.Join(parts, " "+f.op+" ") + ")", nil
+}
+
+func (f *logicalFilter) negate() Filter {
+	negated := make([]Filter, 0, len(f.filters))
+	for _, filter := range f.filters {
+		negated = append(negated, filter.negate())
+	}
+	if f.op == "AND" {
+		return Or(negated...)
+	}
+	return And(negated...)
+}
+
+// Not matches documents not matching filter
+func Not(filter Filter) Filter {
+	if filter == nil {
+		return nil
+	}
+	return filter.negate()
+}
+
+var negatedOps = map[string]string{
+	"=":      "!=",
+	"!=":     "=",
+	"<":      ">=",
+	"<=":     ">",
+	">":      "<=",
+	">=":     "<",
+	"IN":     "NOT IN",
+	"NOT IN": "IN",
+}
+
+type compareFilter struct {
+	field string
+	op    string
+	value any
+}
+
+// Compare filters field with operator =, !=, <, <=, >, >=, IN or NOT IN
+func Compare(field, op string, value any) Filter {
+	return &compareFilter{field: field, op: strings.ToUpper(strings.TrimSpace(op)), value: value}
+}
+
+func Eq(field string, value any) Filter {
+	return Compare(field, "=", value)
+}
+
+func NotEq(field string, value any) Filter {
+	return Compare(field, "!=", value)
+}
+
+func Gt(field string, value any) Filter {
+	return Compare(field, ">", value)
+}
+
+func Gte(field string, value any) Filter {
+	return Compare(field, ">=", value)
+}
+
+func Lt(field string, value any) Filter {
+	return Compare(field, "<", value)
+}
+
+func Lte(field string, value any) Filter {
+	return Compare(field, "<=", value)
+}
+
+// In matches field equal to any of values, values is a slice
+func In(field string, values any) Filter {
+	return Compare(field, "IN", values)
+}
+
+func NotIn(field string, values any) Filter {
+	return Compare(field, "NOT IN", values)
+}
+
+func (f *compareFilter) SQL() (string, error) {
+	field, err := QuoteIdentifier(f.field)
+	if err != nil {
+		return "", err
+	}
+	value, err := compareValue(f.op, f.value)
+	if err != nil {
+		return "", fmt.Errorf("filter %s: %w", f.field, err)
+	}
+	return field + " " + f.op + " " + value, nil
+}
+
+func (f *compareFilter) negate() Filter {
+	return &compareFilter{field: f.field, op: negatedOps[f.op], value: f.value}
+}
+
+type rangeFilter struct {
+	field string
+	min   any
+	max   any
+}
+
+// Range matches min <= field <= max, nil bound is open
+func Range(field string, min, max any) Filter {
+	switch {
+	case min == nil && max == nil:
+		return nil
+	case min == nil:
+		return Lte(field, max)
+	case max == nil:
+		return Gte(field, min)
+	}
+	return &rangeFilter{field: field, min: min, max: max}
+}
+
+func (f *rangeFilter) SQL() (string, error) {
+	field, err := QuoteIdentifier(f.field)
+	if err != nil {
+		return "", err
+	}
+	min, err := formatArg(f.min)
+	if err != nil {
+		return "", fmt.Errorf("filter %s: %w", f.field, err)
+	}
+	max, err := formatArg(f.max)
+	if err != nil {
+		return "", fmt.Errorf("filter %s: %w", f.field, err)
+	}
+	return field + " BETWEEN " + min + " AND " + max, nil
+}
+
+func (f *rangeFilter) negate() Filter {
+	return Or(Lt(f.field, f.min), Gt(f.field, f.max))
+}
+
+type mvaFilter struct {
+	fn    string
+	field string
+	op    string
+	value any
+}
+
+// Any matches multi-value field having any value satisfying op, e.g. Any("tags", "IN", []int{1, 2})
+func Any(field, op string, value any) Filter {
+	return &mvaFilter{fn: "ANY", field: field, op: strings.ToUpper(strings.TrimSpace(op)), value: value}
+}
+
+// All matches multi-value field which all values satisfy op, e.g. All("sizes", ">", 40)
+func All(field, op string, value any) Filter {
+	return &mvaFilter{fn: "ALL", field: field, op: strings.ToUpper(strings.TrimSpace(op)), value: value}
+}
+
+func (f *mvaFilter) SQL() (string, error) {
+	field, err := QuoteIdentifier(f.field)
+	if err != nil {
+		return "", err
+	}
+	value, err := compareValue(f.op, f.value)
+	if err != nil {
+		return "", fmt.Errorf("filter %s: %w", f.field, err)
+	}
+	return f.fn + "(" + field + ") " + f.op + " " + value, nil
+}
+
+func (f *mvaFilter) negate() Filter {
+	fn := "ALL"
+	if f.fn == "ALL" {
+		fn = "ANY"
+	}
+	return &mvaFilter{fn: fn, field: f.field, op: negatedOps[f.op], value: f.value}
+}
+
+type geoFilter struct {
+	latField string
+	lonField string
+	lat      float64
+	lon      float64
+	meters   float64
+	within   bool
+}
+
+// GeoDistance matches documents within meters of the point, coordinates are in degrees
+func GeoDistance(latField, lonField string, lat, lon, meters float64) Filter {
+	return &geoFilter{latField: latField, lonField: lonField, lat: lat, lon: lon, meters: meters, within: true}
+}
+
+func (f *geoFilter) SQL() (string, error) {
+	latField, err := QuoteIdentifier(f.latField)
+	if err != nil {
+		return "", err
+	}
+	lonField, err := QuoteIdentifier(f.lonField)
+	if err != nil {
+		return "", err
+	}
+	values := make([]string, 0, 3)
+	for _, v := range []float64{f.lat, f.lon, f.meters} {
+		value, err := formatFloat(v, 64)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	op := "<="
+	if !f.within {
+		op = ">"
+	}
+	return fmt.Sprintf("GEODIST(%s, %s, %s, %s, {in=degrees, out=meters}) %s %s",
+		latField, lonField, values[0], values[1], op, values[2]), nil
+}
+
+func (f *geoFilter) negate() Filter {
+	negated := *f
+	negated.within = !f.within
+	return &negated
+}
+
+type rawFilter struct {
+	query string
+	args  []any
+}
+
+// Raw filter of query with ? placeholders, see Where. It can not be negated by Not, negate the query itself.
+func Raw(query string, args ...any) Filter {
+	return &rawFilter{query: query, args: args}
+}
+
+func (f *rawFilter) SQL() (string, error) {
+	query, err := replacePlaceholders(f.query, f.args)
+	if err != nil {
+		return "", err
+	}
+	return "(" + query + ")", nil
+}
+
+func (f *rawFilter) negate() Filter {
+	return errFilter{err: errors.New("raw filter can not be negated")}
+}
+
+func compareValue(op string, value any) (string, error) {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return formatArg(value)
+	case "IN", "NOT IN":
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return "", fmt.Errorf("%s value must be a slice", op)
+		}
+		if rv.Len() == 0 {
+			return "", fmt.Errorf("%s value is empty", op)
+		}
+		return formatArg(value)
+	default:
+		return "", fmt.Errorf("unsupported operator %q", op)
+	}
+}
+
+// FilterSpec structured filter, e.g. decoded from JSON request:
+//
+//	{"and": [{"field": "price", "op": "range", "min": 10, "max": 20}, {"not": {"field": "tags", "op": "any", "value": [1, 2]}}]}
+type FilterSpec struct {
+	And []FilterSpec `json:"and,omitempty"`
+	Or  []FilterSpec `json:"or,omitempty"`
+	Not *FilterSpec  `json:"not,omitempty"`
+
+	Field string `json:"field,omitempty"`
+	// Op eq, ne, gt, gte, lt, lte, in, nin, range, any (MVA contains any of values), all (MVA values all in values)
+	Op    string `json:"op,omitempty"`
+	Value any    `json:"value,omitempty"`
+	Min   any    `json:"min,omitempty"`
+	Max   any    `json:"max,omitempty"`
+
+	Geo *GeoSpec `json:"geo,omitempty"`
+}
+
+type GeoSpec struct {
+	LatField string  `json:"latField"`
+	LonField string  `json:"lonField"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Meters   float64 `json:"meters"`
+}
+
+// Filter builds filter tree of spec, when fields are passed only they may be filtered
+func (s FilterSpec) Filter(fields ...string) (Filter, error) {
+	allowed := func(field string) error {
+		if len(fields) == 0 {
+			return nil
+		}
+		for _, f := range fields {
+			if f == field {
+				return nil
+			}
+		}
+		return fmt.Errorf("filter by %s is not allowed", field)
+	}
+
+	filters := make([]Filter, 0)
+	for _, spec := range s.And {
+		filter, err := spec.Filter(fields...)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	if len(s.Or) > 0 {
+		or := make([]Filter, 0, len(s.Or))
+		for _, spec := range s.Or {
+			filter, err := spec.Filter(fields...)
+			if err != nil {
+				return nil, err
+			}
+			or = append(or, filter)
+		}
+		filters = append(filters, Or(or...))
+	}
+	if s.Not != nil {
+		filter, err := s.Not.Filter(fields...)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, Not(filter))
+	}
+	if s.Geo != nil {
+		if err := errors.Join(allowed(s.Geo.LatField), allowed(s.Geo.LonField)); err != nil {
+			return nil, err
+		}
+		filters = append(filters, GeoDistance(s.Geo.LatField, s.Geo.LonField, s.Geo.Lat, s.Geo.Lon, s.Geo.Meters))
+	}
+	if s.Field != "" {
+		if err := allowed(s.Field); err != nil {
+			return nil, err
+		}
+		filter, err := s.leaf()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return And(filters...), nil
+}
+
+func (s FilterSpec) leaf() (Filter, error) {
+	switch strings.ToLower(s.Op) {
+	case "", "eq":
+		return Eq(s.Field, s.Value), nil
+	case "ne":
+		return NotEq(s.Field, s.Value), nil
+	case "gt":
+		return Gt(s.Field, s.Value), nil
+	case "gte":
+		return Gte(s.Field, s.Value), nil
+	case "lt":
+		return Lt(s.Field, s.Value), nil
+	case "lte":
+		return Lte(s.Field, s.Value), nil
+	case "in":
+		return In(s.Field, s.Value), nil
+	case "nin":
+		return NotIn(s.Field, s.Value), nil
+	case "range":
+		return Range(s.Field, s.Min, s.Max), nil
+	case "any":
+		return Any(s.Field, "IN", s.Value), nil
+	case "all":
+		return All(s.Field, "IN", s.Value), nil
+	default:
+		return nil, errors.New("unsupported filter operator " + strconv.Quote(s.Op))
+	}
+}
+
+// whereSQL renders filter as WHERE clause with leading space or empty string without filter
+func whereSQL(filter Filter) (string, error) {
+	if filter == nil {
+		return "", nil
+	}
+	where, err := filter.SQL()
+	if err != nil {
+		return "", err
+	}
+	// the top level AND or OR needs no parentheses
+	if _, ok := filter.(*logicalFilter); ok {
+		where = where[1 : len(where)-1]
+	}
+	return " WHERE " + where, nil
+}
+
+// matchFilter renders full-text conditions as a single MATCH: (and and) | or | or
+type matchFilter struct {
+	and []string
+	or  []string
+}
+
+func (f *matchFilter) SQL() (string, error) {
+	if len(f.and) == 1 && len(f.or) == 0 {
+		return "MATCH(" + QuoteString(f.and[0]) + ")", nil
+	}
+	alternatives := make([]string, 0, len(f.or)+1)
+	if len(f.and) > 0 {
+		alternatives = append(alternatives, "("+strings.Join(f.and, ") (")+")")
+	}
+	for _, expr := range f.or {
+		alternatives = append(alternatives, "("+expr+")")
+	}
+	expr := alternatives[0]
+	if len(alternatives) > 1 {
+		expr = "(" + strings.Join(alternatives, " | ") + ")"
+	}
+	return "MATCH(" + QuoteString(expr) + ")", nil
+}
+
+func (f *matchFilter) negate() Filter {
+	return errFilter{err: errors.New("full-text condition can not be negated")}
+}
+
+// errFilter fails rendering of the tree it belongs to
+type errFilter struct {
+	err error
+}
+
+func (f errFilter) SQL() (string, error) {
+	return "", f.err
+}
+
+func (f errFilter) negate() Filter {
+	return f
+}
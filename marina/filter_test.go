@@ -0,0 +1,191 @@
+package marina
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFilterSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		want    string
+		wantErr bool
+	}{
+		{name: "eq", filter: Eq("status", 1), want: "`status` = 1"},
+		{name: "string", filter: Eq("sku", "AB'1"), want: "`sku` = 'AB\\'1'"},
+		{name: "json path", filter: Gt("meta.price", 9.5), want: "meta.price > 9.5"},
+		{name: "in", filter: In("id", []int{1, 2}), want: "`id` IN (1,2)"},
+		{name: "empty in", filter: In("id", []int{}), wantErr: true},
+		{name: "in scalar", filter: In("id", 1), wantErr: true},
+		{name: "range", filter: Range("price", 10, 20), want: "`price` BETWEEN 10 AND 20"},
+		{name: "open range", filter: Range("price", nil, 20), want: "`price` <= 20"},
+		{name: "any", filter: Any("tags", "in", []uint32{3, 4}), want: "ANY(`tags`) IN (3,4)"},
+		{name: "all", filter: All("sizes", ">", 40), want: "ALL(`sizes`) > 40"},
+		{
+			name:   "geo",
+			filter: GeoDistance("lat", "lon", 55.75, 37.61, 1000),
+			want:   "GEODIST(`lat`, `lon`, 55.75, 37.61, {in=degrees, out=meters}) <= 1000",
+		},
+		{
+			name:   "and of or",
+			filter: And(Eq("a", 1), Or(Eq("b", 2), Eq("c", 3))),
+			want:   "(`a` = 1 AND (`b` = 2 OR `c` = 3))",
+		},
+		{
+			name:   "flattened",
+			filter: And(Eq("a", 1), And(Eq("b", 2), nil), Eq("c", 3)),
+			want:   "(`a` = 1 AND `b` = 2 AND `c` = 3)",
+		},
+		{name: "single", filter: Or(nil, Eq("a", 1)), want: "`a` = 1"},
+		{
+			name:   "not",
+			filter: Not(And(Eq("a", 1), In("b", []int{2}), Range("c", 1, 5))),
+			want:   "(`a` != 1 OR `b` NOT IN (2) OR `c` < 1 OR `c` > 5)",
+		},
+		{name: "not any", filter: Not(Any("tags", "=", 1)), want: "ALL(`tags`) != 1"},
+		{name: "raw", filter: Raw("a = ? OR b = ?", 1, "x"), want: "(a = 1 OR b = 'x')"},
+		{name: "not raw", filter: Not(Or(Eq("a", 1), Raw("b = ?", 2))), wantErr: true},
+		{name: "invalid field", filter: Eq("a b", 1), wantErr: true},
+		{name: "invalid operator", filter: Compare("a", "LIKE", "x"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.SQL()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SQL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		fields  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "leaf", spec: `{"field": "status", "value": 1}`, want: "`status` = 1"},
+		{
+			name: "tree",
+			spec: `{"and": [{"field": "price", "op": "range", "min": 10, "max": 20}, {"or": [{"field": "tags", "op": "any", "value": [1, 2]}, {"not": {"field": "brand", "op": "in", "value": ["x"]}}]}]}`,
+			want: "(`price` BETWEEN 10 AND 20 AND (ANY(`tags`) IN (1,2) OR `brand` NOT IN ('x')))",
+		},
+		{
+			name: "geo",
+			spec: `{"geo": {"latField": "lat", "lonField": "lon", "lat": 1, "lon": 2, "meters": 300}}`,
+			want: "GEODIST(`lat`, `lon`, 1, 2, {in=degrees, out=meters}) <= 300",
+		},
+		{name: "allowed", spec: `{"field": "price", "op": "gte", "value": 5}`, fields: []string{"price"}, want: "`price` >= 5"},
+		{name: "not allowed", spec: `{"field": "secret", "value": 5}`, fields: []string{"price"}, wantErr: true},
+		{name: "unknown operator", spec: `{"field": "price", "op": "like", "value": 5}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec FilterSpec
+			if err := json.Unmarshal([]byte(tt.spec), &spec); err != nil {
+				t.Fatal(err)
+			}
+			filter, err := spec.Filter(tt.fields...)
+			if err == nil {
+				var got string
+				got, err = filter.SQL()
+				if got != tt.want {
+					t.Errorf("SQL() = %s, want %s", got, tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Filter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSearchQueryWhere(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(sq *SearchQuery)
+		want  string
+	}{
+		{name: "no conditions", build: func(sq *SearchQuery) {}, want: "SELECT id FROM products;SHOW META;"},
+		{
+			name: "where and or",
+			build: func(sq *SearchQuery) {
+				sq.Where("a = ?", 1).Where("b = ?", 2).WhereOr("c = ?", 3)
+			},
+			want: "SELECT id FROM products WHERE ((a = 1) AND (b = 2)) OR (c = 3);SHOW META;",
+		},
+		{
+			name: "or in",
+			build: func(sq *SearchQuery) {
+				sq.In("a", []int{1}).OrIn("b", []int{2})
+			},
+			want: "SELECT id FROM products WHERE `a` IN (1) OR `b` IN (2);SHOW META;",
+		},
+		{
+			name: "group",
+			build: func(sq *SearchQuery) {
+				sq.Where("a = ?", 1)
+				sq.WhereGroup(NewWhereGroup("and").Where("b = 2").WhereOr("c = 3"))
+			},
+			want: "SELECT id FROM products WHERE (a = 1) AND ((b = 2) OR (c = 3));SHOW META;",
+		},
+		{
+			name: "match",
+			build: func(sq *SearchQuery) {
+				sq.Match("tv").OrMatch("radio").Filter(Or(Eq("a", 1), Eq("b", 2)))
+			},
+			want: "SELECT id FROM products WHERE MATCH('((^tv*) | (radio*))') AND (`a` = 1 OR `b` = 2);SHOW META;",
+		},
+		{
+			name: "in",
+			build: func(sq *SearchQuery) {
+				sq.In("a", []string{"x"})
+			},
+			want: "SELECT id FROM products WHERE `a` IN ('x');SHOW META;",
+		},
+		{
+			name: "no count",
+			build: func(sq *SearchQuery) {
+				sq.NoCount().Facet("brand_id")
+			},
+			want: "SELECT id FROM products FACET `brand_id`;",
+		},
+		{
+			name: "order",
+			build: func(sq *SearchQuery) {
+				sq.Order("id DESC").Limit(10)
+			},
+			want: "SELECT id FROM products ORDER BY id DESC LIMIT 10;SHOW META;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sq := (&marinaClient{}).NewSearch().Index("products")
+			tt.build(sq)
+			got, err := sq.Query()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Query() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	q := (&marinaClient{}).NewDelete().Index("products").Filter(Range("price", 1, 2)).Where("id > ?", 5)
+	got, err := q.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "DELETE FROM products WHERE `price` BETWEEN 1 AND 2 AND (id > 5);"; got != want {
+		t.Errorf("Query() = %s, want %s", got, want)
+	}
+}
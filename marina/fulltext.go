@@ -0,0 +1,282 @@
+package marina
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Text full-text query expression used in MATCH, user words are escaped by the constructors
+type Text interface {
+	Expression() (string, error)
+}
+
+type textFunc func() (string, error)
+
+func (f textFunc) Expression() (string, error) {
+	return f()
+}
+
+// Term matches word in any form the index morphology allows
+func Term(word string) Text {
+	return textFunc(func() (string, error) {
+		return escapeWord(word)
+	})
+}
+
+// Exact matches exact form of word, the index needs index_exact_words
+func Exact(word string) Text {
+	return textFunc(func() (string, error) {
+		escaped, err := escapeWord(word)
+		if err != nil {
+			return "", err
+		}
+		return "=" + escaped, nil
+	})
+}
+
+// Prefix matches words starting with prefix, the index needs min_prefix_len
+func Prefix(prefix string) Text {
+	return textFunc(func() (string, error) {
+		escaped, err := escapeWord(prefix)
+		if err != nil {
+			return "", err
+		}
+		return escaped + "*", nil
+	})
+}
+
+// Words matches all words of user text
+func Words(text string) Text {
+	return textFunc(func() (string, error) {
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			return "", errors.New("full-text query is empty")
+		}
+		for i, word := range words {
+			words[i] = EscapeMatch(word)
+		}
+		return strings.Join(words, " "), nil
+	})
+}
+
+// Phrase matches words in the given order next to each other
+func Phrase(words ...string) Text {
+	return textFunc(func() (string, error) {
+		return quoteWords(words)
+	})
+}
+
+// Proximity matches words within distance words of each other
+func Proximity(distance int, words ...string) Text {
+	return textFunc(func() (string, error) {
+		if distance < 1 {
+			return "", errors.New("proximity distance must be positive")
+		}
+		phrase, err := quoteWords(words)
+		if err != nil {
+			return "", err
+		}
+		return phrase + "~" + strconv.Itoa(distance), nil
+	})
+}
+
+// Quorum matches at least threshold words, a threshold below 1 is a share of words, e.g. 0.5
+func Quorum(threshold float64, words ...string) Text {
+	return textFunc(func() (string, error) {
+		share := threshold > 0 && threshold < 1
+		count := threshold >= 1 && !math.IsInf(threshold, 1) && threshold == math.Trunc(threshold)
+		if !share && !count {
+			return "", fmt.Errorf("quorum threshold %v must be a whole number of words or a share between 0 and 1", threshold)
+		}
+		phrase, err := quoteWords(words)
+		if err != nil {
+			return "", err
+		}
+		value, err := formatFloat(threshold, 64)
+		if err != nil {
+			return "", err
+		}
+		return phrase + "/" + value, nil
+	})
+}
+
+// InFields limits query to fields, e.g. @title or @(title,description)
+func InFields(query Text, fields ...string) Text {
+	return textFunc(func() (string, error) {
+		if len(fields) == 0 {
+			return "", errors.New("full-text fields are empty")
+		}
+		for _, field := range fields {
+			if !identifierRE.MatchString(field) || strings.Contains(field, ".") {
+				return "", fmt.Errorf("invalid full-text field %q", field)
+			}
+		}
+		expr, err := query.Expression()
+		if err != nil {
+			return "", err
+		}
+		if len(fields) == 1 {
+			return "@" + fields[0] + " (" + expr + ")", nil
+		}
+		return "@(" + strings.Join(fields, ",") + ") (" + expr + ")", nil
+	})
+}
+
+// AllOf matches documents matching all queries
+func AllOf(queries ...Text) Text {
+	return joinText(" ", queries)
+}
+
+// AnyOf matches documents matching any of queries
+func AnyOf(queries ...Text) Text {
+	return joinText(" | ", queries)
+}
+
+// Without excludes documents matching excluded from query
+func Without(query Text, excluded Text) Text {
+	return textFunc(func() (string, error) {
+		expr, err := query.Expression()
+		if err != nil {
+			return "", err
+		}
+		not, err := excluded.Expression()
+		if err != nil {
+			return "", err
+		}
+		return "(" + expr + ") -(" + not + ")", nil
+	})
+}
+
+// RawText trusted full-text expression, it is not escaped
+func RawText(expr string) Text {
+	return textFunc(func() (string, error) {
+		return expr, nil
+	})
+}
+
+func joinText(sep string, queries []Text) Text {
+	return textFunc(func() (string, error) {
+		if len(queries) == 0 {
+			return "", errors.New("full-text query is empty")
+		}
+		parts := make([]string, 0, len(queries))
+		for _, query := range queries {
+			expr, err := query.Expression()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "("+expr+")")
+		}
+		return strings.Join(parts, sep), nil
+	})
+}
+
+func escapeWord(word string) (string, error) {
+	word = strings.TrimSpace(word)
+	if word == "" || strings.ContainsFunc(word, unicode.IsSpace) {
+		return "", fmt.Errorf("invalid full-text word %q", word)
+	}
+	return EscapeMatch(word), nil
+}
+
+func quoteWords(words []string) (string, error) {
+	escaped := make([]string, 0, len(words))
+	for _, word := range words {
+		for _, w := range strings.Fields(word) {
+			escaped = append(escaped, EscapeMatch(w))
+		}
+	}
+	if len(escaped) == 0 {
+		return "", errors.New("full-text phrase is empty")
+	}
+	return `"` + strings.Join(escaped, " ") + `"`, nil
+}
+
+// rankers built in Manticore rankers, expr rankers are set by RankerExpr
+var rankers = map[string]bool{
+	"proximity_bm25": true,
+	"bm25":           true,
+	"none":           true,
+	"wordcount":      true,
+	"proximity":      true,
+	"matchany":       true,
+	"fieldmask":      true,
+	"sph04":          true,
+}
+
+// MatchText adds full-text query built with the DSL, joined with other Match queries by AND
+func (sq *SearchQuery) MatchText(query Text) *SearchQuery {
+	expr, err := query.Expression()
+	if err != nil {
+		sq.err = err
+		return sq
+	}
+	sq.match = append(sq.match, expr)
+	return sq
+}
+
+// OrMatchText adds alternative full-text query built with the DSL, see OrMatch
+func (sq *SearchQuery) OrMatchText(query Text) *SearchQuery {
+	expr, err := query.Expression()
+	if err != nil {
+		sq.err = err
+		return sq
+	}
+	sq.matchOr = append(sq.matchOr, expr)
+	return sq
+}
+
+// FieldWeights sets OPTION field_weights, fields not listed weigh 1
+func (sq *SearchQuery) FieldWeights(weights map[string]int) *SearchQuery {
+	sq.fieldWeights = weights
+	return sq
+}
+
+// Ranker sets OPTION ranker, e.g. bm25 or sph04
+func (sq *SearchQuery) Ranker(name string) *SearchQuery {
+	name = strings.ToLower(name)
+	if !rankers[name] {
+		sq.err = fmt.Errorf("unknown ranker %q", name)
+		return sq
+	}
+	sq.ranker = name
+	return sq
+}
+
+// RankerExpr sets expression ranker, e.g. sum(lcs*user_weight)*1000+bm25
+func (sq *SearchQuery) RankerExpr(expr string) *SearchQuery {
+	sq.ranker = "expr(" + QuoteString(expr) + ")"
+	return sq
+}
+
+// optionSQL renders OPTION clause of ranking options
+func (sq *SearchQuery) optionSQL() (string, error) {
+	options := make([]string, 0, 2)
+	if len(sq.fieldWeights) > 0 {
+		fields := make([]string, 0, len(sq.fieldWeights))
+		for field := range sq.fieldWeights {
+			if !identifierRE.MatchString(field) || strings.Contains(field, ".") {
+				return "", fmt.Errorf("invalid full-text field %q", field)
+			}
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		weights := make([]string, 0, len(fields))
+		for _, field := range fields {
+			weights = append(weights, field+"="+strconv.Itoa(sq.fieldWeights[field]))
+		}
+		options = append(options, "field_weights=("+strings.Join(weights, ", ")+")")
+	}
+	if sq.ranker != "" {
+		options = append(options, "ranker="+sq.ranker)
+	}
+	if len(options) == 0 {
+		return "", nil
+	}
+	return " OPTION " + strings.Join(options, ", "), nil
+}
@@ -0,0 +1,71 @@
+package marina
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTextExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   Text
+		want    string
+		wantErr bool
+	}{
+		{name: "term", query: Term("e-mail"), want: `e\-mail`},
+		{name: "term with space", query: Term("a b"), wantErr: true},
+		{name: "exact", query: Exact("cats"), want: "=cats"},
+		{name: "prefix", query: Prefix("lap"), want: "lap*"},
+		{name: "words", query: Words(` red  "wine" `), want: `red \"wine\"`},
+		{name: "phrase", query: Phrase("hello world"), want: `"hello world"`},
+		{name: "proximity", query: Proximity(3, "red", "wine"), want: `"red wine"~3`},
+		{name: "quorum", query: Quorum(2, "a", "b", "c"), want: `"a b c"/2`},
+		{name: "quorum share", query: Quorum(0.5, "a", "b"), want: `"a b"/0.5`},
+		{name: "quorum fraction above 1", query: Quorum(1.5, "a", "b"), wantErr: true},
+		{name: "quorum zero", query: Quorum(0, "a", "b"), wantErr: true},
+		{name: "quorum negative", query: Quorum(-2, "a", "b"), wantErr: true},
+		{name: "quorum infinity", query: Quorum(math.Inf(1), "a", "b"), wantErr: true},
+		{name: "quorum nan", query: Quorum(math.NaN(), "a", "b"), wantErr: true},
+		{name: "empty phrase", query: Phrase(" "), wantErr: true},
+		{name: "field", query: InFields(Term("tv"), "title"), want: "@title (tv)"},
+		{name: "fields", query: InFields(Term("tv"), "title", "body"), want: "@(title,body) (tv)"},
+		{name: "invalid field", query: InFields(Term("tv"), "title)"), wantErr: true},
+		{
+			name:  "boolean",
+			query: Without(AnyOf(Term("tv"), AllOf(Exact("smart"), Prefix("phone"))), Term("used")),
+			want:  "((tv) | ((=smart) (phone*))) -(used)",
+		},
+		{name: "injection", query: Term(`x')|@(`), want: `x\'\)\|\@\(`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.Expression()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expression() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchQueryOptions(t *testing.T) {
+	sq := (&marinaClient{}).NewSearch().Index("products").NoCount().
+		MatchText(InFields(Phrase("red wine"), "title")).
+		FieldWeights(map[string]int{"title": 10, "body": 2}).
+		Ranker("SPH04").
+		Facet("brand_id")
+	got, err := sq.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT id FROM products WHERE MATCH('@title ("red wine")') ` +
+		"OPTION field_weights=(body=2, title=10), ranker=sph04 FACET `brand_id`;"
+	if got != want {
+		t.Errorf("Query() = %s, want %s", got, want)
+	}
+	if _, err = (&marinaClient{}).NewSearch().Index("products").Ranker("best").Query(); err == nil {
+		t.Error("Query() with unknown ranker must fail")
+	}
+}
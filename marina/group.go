@@ -1,38 +1,49 @@
 package marina
 
-import "bytes"
+import "strings"
 
+// WhereGroup parenthesized conditions joined to the query conditions with sep, AND or OR
 type WhereGroup struct {
 	sep     string
-	where   [][]byte
-	whereOr [][]byte
-	err     error
+	where   []Filter
+	whereOr []Filter
 }
 
 func NewWhereGroup(sep string) *WhereGroup {
 	return &WhereGroup{
-		sep:     sep,
-		where:   make([][]byte, 0),
-		whereOr: make([][]byte, 0),
+		sep:     strings.ToUpper(strings.TrimSpace(sep)),
+		where:   make([]Filter, 0),
+		whereOr: make([]Filter, 0),
 	}
 }
 
 func (wg *WhereGroup) Where(query string, args ...any) *WhereGroup {
-	qr, err := replacePlaceholders(query, args)
-	if err != nil {
-		wg.err = err
-	}
-	sb := bytes.NewBufferString(qr)
-	wg.where = append(wg.where, sb.Bytes())
+	wg.where = append(wg.where, Raw(query, args...))
 	return wg
 }
 
 func (wg *WhereGroup) WhereOr(query string, args ...any) *WhereGroup {
-	qr, err := replacePlaceholders(query, args)
-	if err != nil {
-		wg.err = err
+	wg.whereOr = append(wg.whereOr, Raw(query, args...))
+	return wg
+}
+
+// Filter adds filter tree condition, joined with other group conditions by AND
+func (wg *WhereGroup) Filter(filter Filter) *WhereGroup {
+	if filter != nil {
+		wg.where = append(wg.where, filter)
 	}
-	sb := bytes.NewBufferString(qr)
-	wg.whereOr = append(wg.whereOr, sb.Bytes())
 	return wg
 }
+
+// filter returns group own conditions: (where AND where) OR whereOr
+func (wg *WhereGroup) filter() Filter {
+	return Or(append([]Filter{And(wg.where...)}, wg.whereOr...)...)
+}
+
+// join joins the group to filter with the group separator
+func (wg *WhereGroup) join(filter Filter) Filter {
+	if wg.sep == "OR" {
+		return Or(filter, wg.filter())
+	}
+	return And(filter, wg.filter())
+}
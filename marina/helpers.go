@@ -3,14 +3,16 @@ package marina
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/ettle/strcase"
 	"github.com/jmoiron/sqlx"
 	"github.com/samber/lo"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type QueryType string
@@ -23,7 +25,7 @@ const (
 	CreateQuery     QueryType = "create"
 	DropQuery       QueryType = "drop"
 	DeleteQuery     QueryType = "delete"
-	OptimizeQuery   QueryType = "optimize"
+	UpdateQuery     QueryType = "update"
 )
 
 // parsers
@@ -37,7 +39,7 @@ func getCount(rows *sql.Rows) (int64, error) {
 			return 0, err
 		}
 	}
-	return total, nil
+	return total, rows.Err()
 }
 
 func getResult(rows *sql.Rows) ([]uint32, error) {
@@ -50,58 +52,7 @@ func getResult(rows *sql.Rows) ([]uint32, error) {
 		result = append(result, uint32(val))
 		continue
 	}
-	return result, nil
-}
-
-func getCountFromMeta(rows *sql.Rows) (int64, error) {
-	for rows.NextResultSet() {
-		var total int64
-		for rows.Next() {
-			value, err := getStringValueFromColumn(rows, "Variable_name")
-			if err != nil {
-				return 0, err
-			}
-			if value == "total_found" {
-				total, err = getIntValueFromColumn(rows, "Value")
-				if err != nil {
-					return 0, err
-				}
-				return total, nil
-			}
-		}
-	}
-	return 0, nil
-}
-
-func getFacets(rows *sql.Rows, filterFields []string) ([]*Facet, error) {
-	var facets []*Facet
-	for rows.NextResultSet() {
-		for rows.Next() {
-			for _, fieldName := range filterFields {
-				var (
-					facet   Facet
-					err     error
-					variant string
-					value   int64
-				)
-				facet.FilterName = fieldName
-				variant, err = getStringValueFromColumn(rows, fieldName)
-				if err != nil {
-					return nil, err
-				}
-				value, err = getIntValueFromColumn(rows, "count(*)")
-				if err != nil {
-					return nil, err
-				}
-				facet.Data = append(facet.Data, &FacetItem{
-					Variant: variant,
-					Value:   value,
-				})
-				facets = append(facets, &facet)
-			}
-		}
-	}
-	return facets, nil
+	return result, rows.Err()
 }
 
 func getIntValueFromColumn(rows *sql.Rows, name string) (int64, error) {
@@ -142,7 +93,7 @@ func getFieldNames(object any) ([]string, error) {
 			fields := make([]string, 0, t.NumField())
 			for i := 0; i < t.NumField(); i++ {
 				f := t.Type().Field(i)
-				if f.IsExported() {
+				if _, ok := columnName(f); f.IsExported() && ok {
 					fields = append(fields, f.Name)
 				}
 			}
@@ -162,52 +113,27 @@ func getFieldValueAndType(object any, name string) (any, string, error) {
 	return nil, "", fmt.Errorf("field %s not valid", name)
 }
 
-func getFieldType(object any, name string) (string, error) {
-	if t := reflect.Indirect(reflect.ValueOf(object)); t.IsValid() {
-		if field := t.FieldByName(name); field.IsValid() {
-			return field.Type().String(), nil
+// getColumnName returns column of struct field, see Column
+func getColumnName(object any, name string) string {
+	if field, ok := reflect.Indirect(reflect.ValueOf(object)).Type().FieldByName(name); ok {
+		if column, ok := columnName(field); ok {
+			return column
 		}
 	}
-	return "", fmt.Errorf("field %s not valid", name)
+	return strcase.ToSnake(name)
 }
 
 // builders
 
-func wrapString(value string) string {
-	val := clearString(value)
-	sb := bytes.NewBufferString("'")
-	if len(val) == 0 {
-		sb.WriteString(" '")
-		return sb.String()
-	}
-	sb.WriteString(val)
-	sb.WriteString("'")
-	return sb.String()
-}
-
-func clearString(item string) string {
-	var (
-		reBreak    string
-		reSymbol   []byte
-		reSpace    []byte
-		reBreakers = regexp.MustCompile(`<.*>`)
-		reSymbols  = regexp.MustCompile("['\"<>/()\\[\\];:*{}!?=\\-+_~`$^&#№%\\\\]")
-		reSpaces   = regexp.MustCompile(`\s+`)
-	)
-	reBreak = reBreakers.ReplaceAllString(item, "")
-	reSymbol = reSymbols.ReplaceAll([]byte(reBreak), []byte(""))
-	reSpace = reSpaces.ReplaceAll(reSymbol, []byte(" "))
-
-	return strings.TrimSpace(string(reSpace))
-}
-
 func buildFieldValue(value any, fieldType string) (string, error) {
 	switch fieldType {
 	case "string":
-		return wrapString(value.(string)), nil
+		return QuoteString(value.(string)), nil
 	case "[]string":
 		val := value.([]string)
-		return wrapString(strings.Join(val, " ")), nil
+		return QuoteString(strings.Join(val, " ")), nil
+	case "time.Time":
+		return strconv.FormatInt(value.(time.Time).Unix(), 10), nil
 	case "bool":
 		if value.(bool) == true {
 			return "true", nil
@@ -275,6 +201,15 @@ func buildFieldValue(value any, fieldType string) (string, error) {
 			return strconv.FormatFloat(x, 'f', -1, 64)
 		})...), nil
 	default:
+		// json attributes
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Map, reflect.Struct, reflect.Slice:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			return QuoteString(string(data)), nil
+		}
 		return "", errors.New("query have unsupported field type: " + fieldType)
 	}
 }
@@ -289,56 +224,3 @@ func buildArrayElement(elements ...string) string {
 	sb.WriteString(")")
 	return sb.String()
 }
-
-func replacePlaceholders(s string, arg []any) (string, error) {
-	n := strings.Count(s, "?")
-	if n != len(arg) {
-		fmt.Println("wrong number of arguments")
-		return "", errors.New("wrong number of arguments")
-	}
-	for i := 0; i < n; i++ {
-		m := strings.Index(s, "?")
-		if m < 0 {
-			break
-		}
-		argument, err := bufArg(arg[i])
-		if err != nil {
-			return "", err
-		}
-		v := s[:m-1] + " " + argument + s[m+1:]
-		s = v
-	}
-	return s, nil
-}
-
-func bufArg(arg any) (string, error) {
-	switch arg.(type) {
-	case int:
-		val := arg.(int)
-		return strconv.FormatInt(int64(val), 10), nil
-	case uint:
-		val := arg.(uint)
-		return strconv.FormatUint(uint64(val), 10), nil
-	case int32:
-		val := arg.(int32)
-		return strconv.FormatInt(int64(val), 10), nil
-	case uint32:
-		val := arg.(uint32)
-		return strconv.FormatUint(uint64(val), 10), nil
-	case string:
-		return wrapString(arg.(string)), nil
-	case int64:
-		return strconv.FormatInt(arg.(int64), 10), nil
-	case uint64:
-		return strconv.FormatUint(arg.(uint64), 10), nil
-	case bool:
-		if arg.(bool) {
-			return "true", nil
-		} else {
-			return "false", nil
-		}
-	default:
-		fmt.Println("query have unsupported field")
-		return "", errors.New("query have unsupported field")
-	}
-}
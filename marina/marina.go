@@ -1,7 +1,6 @@
 package marina
 
 import (
-	"fmt"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
@@ -12,7 +11,7 @@ type Marina struct {
 }
 
 func NewMarina(logger *zap.Logger, cfg *Config) (*Marina, error) {
-	sqlxConnection, err := sqlx.Open("mysql", fmt.Sprintf("server=%s;uid=%s;pwd=%s;database=%s", cfg.Host, cfg.User, cfg.Password, cfg.Database))
+	sqlxConnection, err := sqlx.Open("mysql", cfg.DSN())
 	if err != nil {
 		return nil, err
 	}
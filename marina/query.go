@@ -3,52 +3,77 @@ package marina
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"errors"
-	"github.com/ettle/strcase"
+	"fmt"
 	"github.com/go-sql-driver/mysql"
-	"github.com/jmoiron/sqlx"
+	"reflect"
 	"strings"
 )
 
 type QueryInterface interface {
 	Index(name string) *Query
 	Model(value any) *Query
-	Where(field string, condition string, value any) *Query
+	Where(query string, args ...any) *Query
+	Filter(filter Filter) *Query
+	Set(column string, value any) *Query
+}
+
+// execer runs statements on the connection pool or on the connection of a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
 type Query struct {
 	queryType QueryType
-	conn      *sqlx.DB
+	conn      execer
 	index     string
 	fields    []string
 	query     []string
-	where     [][]byte
+	where     []Filter
 	err       error
 }
 
+func newQuery(conn execer, queryType QueryType) *Query {
+	return &Query{
+		queryType: queryType,
+		conn:      conn,
+		fields:    make([]string, 0),
+		where:     make([]Filter, 0),
+		query:     make([]string, 0),
+	}
+}
+
 // Exec method make request and return error
 func (q *Query) Exec(ctx context.Context) error {
+	_, err := q.ExecAffected(ctx)
+	return err
+}
+
+// ExecAffected method make request and return the number of inserted, updated or deleted documents
+func (q *Query) ExecAffected(ctx context.Context) (int64, error) {
 	if q.err != nil {
-		return q.err
+		return 0, q.err
+	}
+	query, err := q.buildQuery(q.queryType)
+	if err != nil {
+		return 0, err
 	}
-	_, err := q.conn.QueryContext(ctx, q.buildQuery(q.queryType))
+	result, err := q.conn.ExecContext(ctx, query)
 	if err != nil {
 		var mysqlErr *mysql.MySQLError
 		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 && strings.Contains(mysqlErr.Message, "duplicate") {
-			return err
-		}
-		return err
-	}
-	if q.queryType == UpsertQuery {
-		_, err = q.conn.QueryContext(ctx, q.buildQuery(OptimizeQuery))
-		if err != nil {
-			return err
+			return 0, err
 		}
+		return 0, err
 	}
-	return nil
+	return result.RowsAffected()
 }
 
-func (q *Query) Query() string {
+func (q *Query) Query() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
 	return q.buildQuery(q.queryType)
 }
 
@@ -61,14 +86,30 @@ func (q *Query) Index(name string) *Query {
 	return q
 }
 
-// Model set request model
+// Model set request model, update requests set attribute columns of the model schema except id,
+// full-text fields can not be updated and are skipped
 func (q *Query) Model(value any) *Query {
 	fields, err := getFieldNames(value)
 	if err != nil {
 		q.err = err
 		return q
 	}
+	var updatable map[string]bool
+	if q.queryType == UpdateQuery {
+		schema, err := SchemaOf(value)
+		if err != nil {
+			q.err = err
+			return q
+		}
+		updatable = make(map[string]bool, len(schema.Columns))
+		for _, column := range schema.Columns {
+			updatable[column.Name] = column.updatable()
+		}
+	}
 	for _, field := range fields {
+		if updatable != nil && !updatable[getColumnName(value, field)] {
+			continue
+		}
 		val, fieldType, err := getFieldValueAndType(value, field)
 		if err != nil {
 			q.err = err
@@ -80,18 +121,43 @@ func (q *Query) Model(value any) *Query {
 			return q
 		}
 		q.addFieldValue(fieldValue)
-		q.fields = append(q.fields, strcase.ToSnake(field))
+		q.fields = append(q.fields, getColumnName(value, field))
 	}
 	return q
 }
 
 func (q *Query) Where(query string, args ...any) *Query {
-	qr, err := replacePlaceholders(query, args)
+	q.where = append(q.where, Raw(query, args...))
+	return q
+}
+
+// Filter adds filter tree condition, joined with other conditions by AND
+func (q *Query) Filter(filter Filter) *Query {
+	if filter != nil {
+		q.where = append(q.where, filter)
+	}
+	return q
+}
+
+// Set sets column of update request. Slices of numbers update MVA columns, maps and structs
+// are stored as JSON, a dotted column like attrs.color updates a key of JSON column
+func (q *Query) Set(column string, value any) *Query {
+	quoted, err := QuoteIdentifier(column)
 	if err != nil {
 		q.err = err
+		return q
+	}
+	if value == nil {
+		q.err = fmt.Errorf("column %s: value is nil", column)
+		return q
+	}
+	fieldValue, err := buildFieldValue(value, reflect.TypeOf(value).String())
+	if err != nil {
+		q.err = fmt.Errorf("column %s: %w", column, err)
+		return q
 	}
-	sb := bytes.NewBufferString(qr)
-	q.where = append(q.where, sb.Bytes())
+	q.addFieldValue(fieldValue)
+	q.fields = append(q.fields, quoted)
 	return q
 }
 
@@ -99,25 +165,41 @@ func (q *Query) addFieldValue(value string) {
 	q.query = append(q.query, value)
 }
 
-func (q *Query) buildQuery(qType QueryType) string {
+func (q *Query) buildQuery(qType QueryType) (string, error) {
+	where, err := whereSQL(And(q.where...))
+	if err != nil {
+		return "", err
+	}
 	sb := bytes.NewBufferString("")
 	switch qType {
-	case OptimizeQuery:
-		sb := bytes.NewBufferString("OPTIMIZE INDEX ")
-		sb.WriteString(q.index)
-		sb.WriteString(";")
-		return sb.String()
 	case DeleteQuery:
+		if where == "" {
+			return "", errors.New("delete without filter, use TRUNCATE TABLE to delete all documents")
+		}
 		sb.WriteString("DELETE FROM ")
 		sb.WriteString(q.index)
-		if len(q.where) != 0 {
-			sb.WriteString(" WHERE ")
+		sb.WriteString(where)
+		sb.WriteString(";")
+		return sb.String(), nil
+	case UpdateQuery:
+		if where == "" {
+			return "", errors.New("update without filter")
+		}
+		sets := make([]string, 0, len(q.fields))
+		for i, field := range q.fields {
+			if field != "id" && field != "`id`" {
+				sets = append(sets, field+" = "+q.query[i])
+			}
 		}
-		if len(q.where) != 0 {
-			sb.Write(bytes.Join(q.where, []byte(" AND ")))
+		if len(sets) == 0 {
+			return "", errors.New("update without values")
 		}
+		sb.WriteString("UPDATE ")
+		sb.WriteString(q.index)
+		sb.WriteString(" SET ")
+		sb.WriteString(strings.Join(sets, ", "))
+		sb.WriteString(where)
 		sb.WriteString(";")
-		return sb.String()
 	case InsertQuery:
 		sb.WriteString("INSERT INTO ")
 		sb.WriteString(q.index)
@@ -134,17 +216,11 @@ func (q *Query) buildQuery(qType QueryType) string {
 		sb.WriteString(") VALUES (")
 		sb.WriteString(strings.Join(q.query, ", "))
 		sb.WriteString(")")
-		if len(q.where) != 0 {
-			sb.WriteString(" WHERE ")
-		}
-		if len(q.where) != 0 {
-			sb.Write(bytes.Join(q.where, []byte(" AND ")))
-		}
+		sb.WriteString(where)
 		sb.WriteString(";")
-		return sb.String()
+		return sb.String(), nil
 	default:
-		q.err = errors.New("invalid query type")
-		return ""
+		return "", errors.New("invalid query type")
 	}
-	return sb.String()
+	return sb.String(), nil
 }
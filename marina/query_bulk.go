@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"github.com/ettle/strcase"
+	"fmt"
 	"github.com/go-sql-driver/mysql"
-	"github.com/jmoiron/sqlx"
 	"strings"
 )
 
@@ -19,19 +18,28 @@ type BulkQueryInterface interface {
 
 type BulkQuery struct {
 	queryType QueryType
-	conn      *sqlx.DB
+	conn      execer
 	index     string
 	fields    []string
 	query     []string
 	err       error
 }
 
+func newBulkQuery(conn execer, queryType QueryType) *BulkQuery {
+	return &BulkQuery{
+		queryType: queryType,
+		conn:      conn,
+		fields:    make([]string, 0),
+		query:     make([]string, 0),
+	}
+}
+
 // Exec method make bulk request and return error
 func (bq *BulkQuery) Exec(ctx context.Context) error {
 	if bq.err != nil {
 		return bq.err
 	}
-	_, err := bq.conn.QueryContext(ctx, bq.buildBulkQuery())
+	_, err := bq.conn.ExecContext(ctx, bq.buildBulkQuery())
 	if err != nil {
 		var mysqlErr *mysql.MySQLError
 		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 && strings.Contains(mysqlErr.Message, "duplicate") {
@@ -39,12 +47,6 @@ func (bq *BulkQuery) Exec(ctx context.Context) error {
 		}
 		return err
 	}
-	if bq.queryType == BulkUpsertQuery {
-		_, err = bq.conn.QueryContext(ctx, bq.optimizeIndexQuery())
-		if err != nil {
-			return err
-		}
-	}
 	return nil
 }
 
@@ -65,10 +67,11 @@ func (bq *BulkQuery) Index(name string) *BulkQuery {
 	return bq
 }
 
-// Model set request models
+// Model set request models, models are structs of the same type
 func (bq *BulkQuery) Model(models ...any) *BulkQuery {
 	if len(models) == 0 {
 		bq.err = errors.New("have not models to bulk insert")
+		return bq
 	}
 	fields, err := getFieldNames(models[0])
 	if err != nil {
@@ -76,62 +79,63 @@ func (bq *BulkQuery) Model(models ...any) *BulkQuery {
 		return bq
 	}
 	for _, model := range models {
-		bulkElement := make([]string, 0)
-		for _, field := range fields {
-			val, fieldType, errType := getFieldValueAndType(model, field)
-			if err != nil {
-				bq.err = errType
-				return bq
-			}
-			fieldValue, errVal := buildFieldValue(val, fieldType)
-			if err != nil {
-				bq.err = errVal
-				return bq
-			}
-			bulkElement = append(bulkElement, fieldValue)
+		row, err := modelRow(model, fields)
+		if err != nil {
+			bq.err = err
+			return bq
 		}
-		bq.addBulkElement(bulkElement...)
-	}
-	for _, field := range fields {
-		bq.fields = append(bq.fields, strcase.ToSnake(field))
+		bq.query = append(bq.query, row)
 	}
-
+	bq.fields = modelColumns(models[0], fields)
 	return bq
 }
 
-func (bq *BulkQuery) addBulkElement(element ...string) {
-	buffer := bytes.NewBufferString("(")
-	buffer.WriteString(strings.Join(element, ", "))
-	buffer.WriteString(")")
-	bq.query = append(bq.query, buffer.String())
+func (bq *BulkQuery) buildBulkQuery() string {
+	return bulkStatement(bq.queryType, bq.index, bq.fields, bq.query)
 }
 
-func (bq *BulkQuery) buildBulkQuery() string {
+// bulkStatement renders INSERT or REPLACE of rows
+func bulkStatement(queryType QueryType, index string, columns []string, rows []string) string {
 	sb := bytes.NewBufferString("")
-	switch bq.queryType {
+	switch queryType {
 	case BulkInsertQuery:
 		sb.WriteString("INSERT INTO ")
-		sb.WriteString(bq.index)
-		sb.WriteString("(")
-		sb.WriteString(strings.Join(bq.fields, ", "))
-		sb.WriteString(") VALUES")
 	case BulkUpsertQuery:
 		sb.WriteString("REPLACE INTO ")
-		sb.WriteString(bq.index)
-		sb.WriteString("(")
-		sb.WriteString(strings.Join(bq.fields, ", "))
-		sb.WriteString(") VALUES")
 	default:
 		return ""
 	}
-	sb.WriteString(strings.Join(bq.query, ", "))
+	sb.WriteString(index)
+	sb.WriteString("(")
+	sb.WriteString(strings.Join(columns, ", "))
+	sb.WriteString(") VALUES")
+	sb.WriteString(strings.Join(rows, ", "))
 	sb.WriteString(";")
 	return sb.String()
 }
 
-func (bq *BulkQuery) optimizeIndexQuery() string {
-	sb := bytes.NewBufferString("OPTIMIZE INDEX ")
-	sb.WriteString(bq.index)
-	sb.WriteString(";")
-	return sb.String()
+// modelRow renders values of model fields as a VALUES row
+func modelRow(model any, fields []string) (string, error) {
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		val, fieldType, err := getFieldValueAndType(model, field)
+		if err != nil {
+			return "", err
+		}
+		value, err := buildFieldValue(val, fieldType)
+		if err != nil {
+			return "", fmt.Errorf("field %s: %w", field, err)
+		}
+		values = append(values, value)
+	}
+	return "(" + strings.Join(values, ", ") + ")", nil
+}
+
+// modelColumns returns columns of model fields
+func modelColumns(model any, fields []string) []string {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, getColumnName(model, field))
+	}
+	return columns
 }
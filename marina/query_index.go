@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"github.com/ettle/strcase"
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	"strings"
@@ -14,13 +13,14 @@ type IndexQueryInterface interface {
 	Exec(ctx context.Context) error
 	Index(name string) *IndexQuery
 	Model(value any) *IndexQuery
+	Options(options TableOptions) *IndexQuery
 }
 
 type IndexQuery struct {
 	queryType QueryType
 	conn      *sqlx.DB
 	index     string
-	fields    [][]byte
+	schema    *Schema
 	err       error
 }
 
@@ -29,7 +29,11 @@ func (tq *IndexQuery) Exec(ctx context.Context) error {
 	if tq.err != nil {
 		return tq.err
 	}
-	_, err := tq.conn.QueryContext(ctx, tq.buildTableQuery())
+	query, err := tq.buildTableQuery()
+	if err != nil {
+		return err
+	}
+	_, err = tq.conn.ExecContext(ctx, query)
 	if err != nil {
 		var mysqlErr *mysql.MySQLError
 		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 && strings.Contains(mysqlErr.Message, "duplicate") {
@@ -41,7 +45,10 @@ func (tq *IndexQuery) Exec(ctx context.Context) error {
 }
 
 // Query method return raw string query to index
-func (tq *IndexQuery) Query() string {
+func (tq *IndexQuery) Query() (string, error) {
+	if tq.err != nil {
+		return "", tq.err
+	}
 	return tq.buildTableQuery()
 }
 
@@ -54,66 +61,44 @@ func (tq *IndexQuery) Index(name string) *IndexQuery {
 	return tq
 }
 
-// Model set request model
+// Model set table schema of model struct tags, see Column
 func (tq *IndexQuery) Model(value any) *IndexQuery {
-	fields, err := getFieldNames(value)
+	options := DefaultTableOptions()
+	if tq.schema != nil {
+		options = tq.schema.Options
+	}
+	schema, err := SchemaOf(value)
 	if err != nil {
 		tq.err = err
 		return tq
 	}
-	for _, field := range fields {
-		fieldType, err := getFieldType(value, field)
-		if err != nil {
-			tq.err = err
-			break
-		}
-		tq.addField(field, fieldType)
-		if tq.err != nil {
-			break
-		}
-	}
+	schema.Options = options
+	tq.schema = schema
 	return tq
 }
 
-func (tq *IndexQuery) addField(field string, fieldType string) {
-	sb := bytes.NewBufferString(strcase.ToSnake(field))
-	switch fieldType {
-	case "string", "[]string":
-		sb.WriteString(" text indexed")
-	case "bool":
-		sb.WriteString(" bool")
-	case "int", "uint", "uint32", "int32":
-		sb.WriteString(" int")
-	case "uint64", "int64":
-		sb.WriteString(" bigint")
-	case "float32", "float64":
-		sb.WriteString(" float")
-	case "[]int", "[]uint", "[]uint32", "[]int32", "[]float32":
-		sb.WriteString(" multi")
-	case "[]uint64", "[]int64", "[]float64":
-		sb.WriteString(" multi64")
-	default:
-		tq.err = errors.New("index query have unsupported field type: " + fieldType)
-		return
+// Options set table options, DefaultTableOptions by default
+func (tq *IndexQuery) Options(options TableOptions) *IndexQuery {
+	if tq.schema == nil {
+		tq.schema = &Schema{}
 	}
-	tq.fields = append(tq.fields, sb.Bytes())
+	tq.schema.Options = options
+	return tq
 }
 
-func (tq *IndexQuery) buildTableQuery() string {
+func (tq *IndexQuery) buildTableQuery() (string, error) {
 	sb := bytes.NewBufferString("")
 	switch tq.queryType {
 	case CreateQuery:
-		sb.WriteString("CREATE TABLE ")
-		sb.WriteString(tq.index)
-		sb.WriteString(" (")
-		sb.Write(bytes.Join(tq.fields, []byte(", ")))
-		sb.WriteString(") dict='keywords' index_exact_words='1' min_infix_len='2'")
+		if tq.schema == nil || len(tq.schema.Columns) == 0 {
+			return "", errors.New("index model is not set")
+		}
+		sb.WriteString(tq.schema.createSQL(tq.index))
 	case DropQuery:
 		sb.WriteString("DROP TABLE IF EXISTS ")
 		sb.WriteString(tq.index)
 	default:
-		tq.err = errors.New("invalid query type")
-		return ""
+		return "", errors.New("invalid query type")
 	}
-	return sb.String()
+	return sb.String(), nil
 }
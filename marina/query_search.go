@@ -3,9 +3,9 @@ package marina
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/jmoiron/sqlx"
-	"github.com/samber/lo"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -13,31 +13,38 @@ import (
 
 type SearchQueryInterface interface {
 	Index(name string) *SearchQuery
-	Where(field string, condition string, value any) *SearchQuery
-	WhereOr(field string, condition string, value any) *SearchQuery
+	Where(query string, args ...any) *SearchQuery
+	WhereOr(query string, args ...any) *SearchQuery
+	Filter(filter Filter) *SearchQuery
 	Limit(limit int64) *SearchQuery
 	Offset(offset int64) *SearchQuery
 	Match(query string) *SearchQuery
 	Order(query string) *SearchQuery
 	Facet(fields ...string) *SearchQuery
-	In(field string, value ...any) *SearchQuery
+	In(field string, values any) *SearchQuery
 }
 
 type SearchQuery struct {
-	conn        *sqlx.DB
-	count       bool
-	meta        bool
-	index       string
-	limit       int64
-	offset      int64
-	groups      []*WhereGroup
-	facetFields []string
-	where       [][]byte
-	whereOr     [][]byte
-	order       [][]byte
-	facet       [][]byte
-	match       [][]byte
-	err         error
+	conn       *sqlx.DB
+	count      bool
+	noCount    bool
+	scan       bool
+	index      string
+	limit      int64
+	offset     int64
+	groups     []*WhereGroup
+	where      []Filter
+	whereOr    []Filter
+	order      [][]byte
+	facets     []FacetOptions
+	match      []string
+	matchOr    []string
+	columns    []string
+	highlights []string
+	// fieldWeights and ranker are full-text ranking options
+	fieldWeights map[string]int
+	ranker       string
+	err          error
 }
 
 // Scan method return founded entity ids and count
@@ -45,34 +52,24 @@ func (sq *SearchQuery) Scan(ctx context.Context) (*SearchResult, error) {
 	if sq.err != nil {
 		return nil, sq.err
 	}
-	searchResult := new(SearchResult)
-
-	rows, err := sq.conn.QueryContext(ctx, sq.selectQuery())
+	rows, err := sq.search(ctx)
 	if err != nil {
 		return nil, err
 	}
-	searchResult.Ids, err = getResult(rows)
-	if err != nil {
+	defer rows.Close()
+
+	searchResult := new(SearchResult)
+	if searchResult.Ids, err = getResult(rows); err != nil {
 		return nil, err
 	}
-
-	if !sq.meta {
-		sq.count = true
-		countResponse, errCount := sq.conn.QueryContext(ctx, sq.selectQuery())
-		if errCount != nil {
-			return nil, errCount
-		}
-		searchResult.Count, err = getCount(countResponse)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		searchResult.Count, err = getCountFromMeta(rows)
-		if err != nil {
-			return nil, err
-		}
+	// facet result sets come before SHOW META, see ScanWithFacet
+	if _, err = getFacets(rows, sq.facets); err != nil {
+		return nil, err
 	}
-
+	if searchResult.Meta, err = sq.readMeta(rows); err != nil {
+		return nil, err
+	}
+	searchResult.Count = searchResult.Meta.TotalFound
 	return searchResult, nil
 }
 
@@ -81,7 +78,7 @@ func (sq *SearchQuery) Query() (string, error) {
 	if sq.err != nil {
 		return "", sq.err
 	}
-	return sq.selectQuery(), nil
+	return sq.selectQuery()
 }
 
 // Count method return founded entity count
@@ -90,15 +87,23 @@ func (sq *SearchQuery) Count(ctx context.Context) (*CountResult, error) {
 		return nil, sq.err
 	}
 	sq.count = true
-	countResult := new(CountResult)
-	countResponse, err := sq.conn.QueryContext(ctx, sq.selectQuery())
+	defer func() {
+		sq.count = false
+	}()
+	query, err := sq.selectQuery()
 	if err != nil {
 		return nil, err
 	}
-	countResult.Count, err = getCount(countResponse)
+	rows, err := sq.conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	countResult := new(CountResult)
+	if countResult.Count, err = getCount(rows); err != nil {
+		return nil, err
+	}
 	return countResult, nil
 }
 
@@ -107,45 +112,54 @@ func (sq *SearchQuery) ScanWithFacet(ctx context.Context) (*SearchWithFacetResul
 	if sq.err != nil {
 		return nil, sq.err
 	}
-	var total int64
-	var result []uint32
-	var facets []*Facet
-
-	rows, err := sq.conn.QueryContext(ctx, sq.selectQuery())
+	rows, err := sq.search(ctx)
 	if err != nil {
 		return nil, err
 	}
-	result, err = getResult(rows)
-	if err != nil {
+	defer rows.Close()
+
+	result := new(SearchWithFacetResult)
+	if result.Ids, err = getResult(rows); err != nil {
 		return nil, err
 	}
-	facets, err = getFacets(rows, sq.facetFields)
+	if result.Facets, err = getFacets(rows, sq.facets); err != nil {
+		return nil, err
+	}
+	result.Buckets = facetResult(result.Facets)
+	if result.Meta, err = sq.readMeta(rows); err != nil {
+		return nil, err
+	}
+	result.Total = result.Meta.TotalFound
+	return result, nil
+}
+
+// NoCount skips SHOW META of the search, Count of results is 0
+func (sq *SearchQuery) NoCount() *SearchQuery {
+	sq.noCount = true
+	return sq
+}
+
+// search runs the select with facets and SHOW META in one multi-statement round trip
+func (sq *SearchQuery) search(ctx context.Context) (*sql.Rows, error) {
+	query, err := sq.selectQuery()
 	if err != nil {
 		return nil, err
 	}
+	return sq.conn.QueryContext(ctx, query)
+}
 
-	if !sq.meta {
-		sq.count = true
-		count, errCount := sq.conn.QueryContext(ctx, sq.selectQuery())
-		if errCount != nil {
-			return nil, err
-		}
-		total, err = getCount(count)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		total, err = getCountFromMeta(rows)
-		if err != nil {
-			return nil, err
+// readMeta reads SHOW META result set following the search and facet result sets
+func (sq *SearchQuery) readMeta(rows *sql.Rows) (Meta, error) {
+	if sq.noCount {
+		return Meta{}, nil
+	}
+	if !rows.NextResultSet() {
+		if err := rows.Err(); err != nil {
+			return Meta{}, err
 		}
+		return Meta{}, errors.New("no SHOW META result, is multiStatements enabled")
 	}
-
-	return &SearchWithFacetResult{
-		Ids:    result,
-		Total:  total,
-		Facets: facets,
-	}, nil
+	return scanMeta(rows)
 }
 
 // Index set index table name
@@ -157,27 +171,27 @@ func (sq *SearchQuery) Index(name string) *SearchQuery {
 	return sq
 }
 
+// WhereGroup joins the group to conditions added before it with the group separator
 func (sq *SearchQuery) WhereGroup(group *WhereGroup) {
 	sq.groups = append(sq.groups, group)
 }
 
-func (sq *SearchQuery) Where(query string, args ...any) *SearchQuery {
-	qr, err := replacePlaceholders(query, args)
-	if err != nil {
-		sq.err = err
+// Filter adds filter tree condition, joined with other conditions by AND
+func (sq *SearchQuery) Filter(filter Filter) *SearchQuery {
+	if filter != nil {
+		sq.where = append(sq.where, filter)
 	}
-	sb := bytes.NewBufferString(qr)
-	sq.where = append(sq.where, sb.Bytes())
 	return sq
 }
 
+func (sq *SearchQuery) Where(query string, args ...any) *SearchQuery {
+	sq.where = append(sq.where, Raw(query, args...))
+	return sq
+}
+
+// WhereOr adds alternative of all Where conditions: (where AND where) OR whereOr OR whereOr
 func (sq *SearchQuery) WhereOr(query string, args ...any) *SearchQuery {
-	qr, err := replacePlaceholders(query, args)
-	if err != nil {
-		sq.err = err
-	}
-	sb := bytes.NewBufferString(qr)
-	sq.whereOr = append(sq.whereOr, sb.Bytes())
+	sq.whereOr = append(sq.whereOr, Raw(query, args...))
 	return sq
 }
 
@@ -192,75 +206,45 @@ func (sq *SearchQuery) Offset(offset int64) *SearchQuery {
 }
 
 func (sq *SearchQuery) Match(query string) *SearchQuery {
-	if query == "" {
-		return sq
-	}
-	query = clearString(query)
-	queryElements := strings.Split(query, " ")
-	lengthQuery := len(queryElements)
-	sb := bytes.NewBufferString("")
-	switch lengthQuery {
-	case 1:
-		if utf8.RuneCountInString(query) < 3 {
-			sb.WriteString("MATCH('^")
-		} else {
-			sb.WriteString("MATCH('")
-		}
-		sb.WriteString(query)
-		sb.WriteString("*')")
-	default:
-		elemsAsterisk := make([][]byte, 0, lengthQuery)
-		for _, element := range queryElements {
-			qry := bytes.NewBufferString("")
-			qry.WriteString("*")
-			qry.WriteString(element)
-			qry.WriteString("*")
-			elemsAsterisk = append(elemsAsterisk, qry.Bytes())
-		}
-		cookedQuery := bytes.Join(elemsAsterisk, []byte(" "))
-		sb.WriteString("MATCH('\"")
-		sb.Write(cookedQuery)
-		sb.WriteString("\"/1')")
+	if expr := matchExpression(query); expr != "" {
+		sq.match = append(sq.match, expr)
 	}
-	sq.where = append(sq.where, sb.Bytes())
-	sq.meta = true
 	return sq
 }
 
+// OrMatch adds alternative of Match queries, Manticore allows a single MATCH ANDed with filters,
+// so alternatives are joined with | inside it
 func (sq *SearchQuery) OrMatch(query string) *SearchQuery {
-	if query == "" {
-		return sq
+	if expr := matchExpression(query); expr != "" {
+		sq.matchOr = append(sq.matchOr, expr)
 	}
-	query = clearString(query)
-	queryElements := strings.Split(query, " ")
-	lengthQuery := len(queryElements)
+	return sq
+}
+
+// matchExpression builds prefix search of a single word or infix quorum search of several words,
+// operators in the user query are escaped
+func matchExpression(query string) string {
+	words := strings.Fields(query)
 	sb := bytes.NewBufferString("")
-	switch lengthQuery {
+	switch len(words) {
+	case 0:
+		return ""
 	case 1:
-		if utf8.RuneCountInString(query) < 3 {
-			sb.WriteString("MATCH('^")
-		} else {
-			sb.WriteString("MATCH('")
+		if utf8.RuneCountInString(words[0]) < 3 {
+			sb.WriteString("^")
 		}
-		sb.WriteString(query)
-		sb.WriteString("*')")
+		sb.WriteString(EscapeMatch(words[0]))
+		sb.WriteString("*")
 	default:
-		elemsAsterisk := make([][]byte, 0, lengthQuery)
-		for _, element := range queryElements {
-			qry := bytes.NewBufferString("")
-			qry.WriteString("*")
-			qry.WriteString(element)
-			qry.WriteString("*")
-			elemsAsterisk = append(elemsAsterisk, qry.Bytes())
+		elemsAsterisk := make([]string, 0, len(words))
+		for _, word := range words {
+			elemsAsterisk = append(elemsAsterisk, "*"+EscapeMatch(word)+"*")
 		}
-		cookedQuery := bytes.Join(elemsAsterisk, []byte(" "))
-		sb.WriteString("MATCH('\"")
-		sb.Write(cookedQuery)
-		sb.WriteString("\"/1')")
+		sb.WriteString("\"")
+		sb.WriteString(strings.Join(elemsAsterisk, " "))
+		sb.WriteString("\"/1")
 	}
-	sq.whereOr = append(sq.whereOr, sb.Bytes())
-	sq.meta = true
-	return sq
+	return sb.String()
 }
 
 func (sq *SearchQuery) Order(query string) *SearchQuery {
@@ -271,165 +255,67 @@ func (sq *SearchQuery) Order(query string) *SearchQuery {
 	return sq
 }
 
+// Facet adds facets by fields with default options, see FacetWith
 func (sq *SearchQuery) Facet(fields ...string) *SearchQuery {
-	if len(fields) == 0 {
-		return sq
-	}
 	for _, field := range fields {
-		sf := bytes.NewBufferString(" FACET ")
-		sf.WriteString(field)
-		sq.facet = append(sq.facet, sf.Bytes())
-		sq.facetFields = append(sq.facetFields, field)
+		sq.FacetWith(FacetOptions{Field: field})
 	}
 	return sq
 }
 
-func (sq *SearchQuery) In(field string, value any) *SearchQuery {
-	sbp := bytes.NewBufferString(field)
-	sbp.WriteString(" IN ")
-	sbp.WriteString("(")
-	vals := make([]string, 0)
-	switch value.(type) {
-	case []int:
-		val := value.([]int)
-		vals = append(vals, lo.Map(val, func(x int, index int) string {
-			return strconv.FormatInt(int64(x), 10)
-		})...)
-	case []uint:
-		val := value.([]uint)
-		vals = append(vals, lo.Map(val, func(x uint, index int) string {
-			return strconv.FormatUint(uint64(x), 10)
-		})...)
-	case []int32:
-		val := value.([]int32)
-		vals = append(vals, lo.Map(val, func(x int32, index int) string {
-			return strconv.FormatInt(int64(x), 10)
-		})...)
-	case []uint32:
-		val := value.([]uint32)
-		vals = append(vals, lo.Map(val, func(x uint32, index int) string {
-			return strconv.FormatUint(uint64(x), 10)
-		})...)
-	case []int64:
-		val := value.([]int64)
-		vals = append(vals, lo.Map(val, func(x int64, index int) string {
-			return strconv.FormatInt(x, 10)
-		})...)
-	case []uint64:
-		val := value.([]uint64)
-		vals = append(vals, lo.Map(val, func(x uint64, index int) string {
-			return strconv.FormatUint(x, 10)
-		})...)
-	case []string:
-		val := value.([]string)
-		vals = append(vals, lo.Map(val, func(x string, index int) string {
-			return wrapString(x)
-		})...)
-	default:
-		sq.err = errors.New("query have unsupported field: " + field)
-	}
-	sbp.WriteString(strings.Join(vals, ", "))
-	sbp.WriteString(")")
-	sq.where = append(sq.where, sbp.Bytes())
+// In adds field IN (values) condition, values is a slice
+func (sq *SearchQuery) In(field string, values any) *SearchQuery {
+	sq.where = append(sq.where, In(field, values))
 	return sq
 }
 
-func (sq *SearchQuery) OrIn(field string, value any) *SearchQuery {
-	sbp := bytes.NewBufferString(field)
-	sbp.WriteString(" IN ")
-	sbp.WriteString("(")
-	vals := make([]string, 0)
-	switch value.(type) {
-	case []int:
-		val := value.([]int)
-		vals = append(vals, lo.Map(val, func(x int, index int) string {
-			return strconv.FormatInt(int64(x), 10)
-		})...)
-	case []uint:
-		val := value.([]uint)
-		vals = append(vals, lo.Map(val, func(x uint, index int) string {
-			return strconv.FormatUint(uint64(x), 10)
-		})...)
-	case []int32:
-		val := value.([]int32)
-		vals = append(vals, lo.Map(val, func(x int32, index int) string {
-			return strconv.FormatInt(int64(x), 10)
-		})...)
-	case []uint32:
-		val := value.([]uint32)
-		vals = append(vals, lo.Map(val, func(x uint32, index int) string {
-			return strconv.FormatUint(uint64(x), 10)
-		})...)
-	case []int64:
-		val := value.([]int64)
-		vals = append(vals, lo.Map(val, func(x int64, index int) string {
-			return strconv.FormatInt(x, 10)
-		})...)
-	case []uint64:
-		val := value.([]uint64)
-		vals = append(vals, lo.Map(val, func(x uint64, index int) string {
-			return strconv.FormatUint(x, 10)
-		})...)
-	case []string:
-		val := value.([]string)
-		vals = append(vals, lo.Map(val, func(x string, index int) string {
-			return wrapString(x)
-		})...)
-	default:
-		sq.err = errors.New("query have unsupported field: " + field)
-	}
-	sbp.WriteString(strings.Join(vals, ", "))
-	sbp.WriteString(")")
-	sq.where = append(sq.whereOr, sbp.Bytes())
+// OrIn adds field IN (values) alternative, see WhereOr
+func (sq *SearchQuery) OrIn(field string, values any) *SearchQuery {
+	sq.whereOr = append(sq.whereOr, In(field, values))
 	return sq
 }
 
-func (sq *SearchQuery) selectQuery() string {
+// filter builds the WHERE tree: where conditions are joined with AND, whereOr conditions are
+// alternatives of them, groups are joined with the result by their separators, MATCH goes first
+func (sq *SearchQuery) filter() Filter {
+	filter := Or(append([]Filter{And(sq.where...)}, sq.whereOr...)...)
+	for _, group := range sq.groups {
+		filter = group.join(filter)
+	}
+	if len(sq.match) == 0 && len(sq.matchOr) == 0 {
+		return filter
+	}
+	return And(&matchFilter{and: sq.match, or: sq.matchOr}, filter)
+}
+
+func (sq *SearchQuery) selectQuery() (string, error) {
 	if len(sq.index) == 0 {
-		sq.err = errors.New("invalid index name")
+		return "", errors.New("invalid index name")
+	}
+	where, err := whereSQL(sq.filter())
+	if err != nil {
+		return "", err
 	}
 	sb := bytes.NewBufferString("SELECT ")
-	if !sq.count {
-		sb.WriteString("id")
-	} else {
+	switch {
+	case sq.count:
 		sb.WriteString("COUNT(*)")
+	case sq.scan:
+		columns, err := sq.selectColumns()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(columns)
+	default:
+		sb.WriteString("id")
 	}
 	sb.WriteString(" FROM ")
 	sb.WriteString(sq.index)
-	if len(sq.where) != 0 || len(sq.whereOr) != 0 || len(sq.groups) != 0 {
-		sb.WriteString(" WHERE ")
-	}
-	if len(sq.where) != 0 {
-		sb.Write(bytes.Join(sq.where, []byte(" AND ")))
-	}
-	if len(sq.whereOr) != 0 {
-		if len(sq.where) != 0 {
-			sb.WriteString(" OR ")
-		}
-		sb.Write(bytes.Join(sq.whereOr, []byte(" OR ")))
-	}
-	for i, group := range sq.groups {
-		if i != 0 || len(sq.where) != 0 || len(sq.whereOr) != 0 {
-			sb.WriteString(group.sep)
-		}
-		sb.WriteString(" (")
-		if len(group.where) != 0 {
-			sb.Write(bytes.Join(sq.where, []byte(" AND ")))
-		}
-		if len(group.whereOr) != 0 {
-			if len(group.where) != 0 {
-				sb.WriteString(" OR ")
-			}
-			sb.Write(bytes.Join(sq.whereOr, []byte(" OR ")))
-		}
-		sb.WriteString(")")
-	}
+	sb.WriteString(where)
 	if len(sq.order) > 0 {
 		sb.WriteString(" ORDER BY ")
 		sb.Write(bytes.Join(sq.order, []byte(", ")))
-		sb.WriteString(" ")
 	}
-	sb.Write(bytes.Join(sq.order, []byte{}))
 	if sq.limit > 0 && !sq.count {
 		sb.WriteString(" LIMIT ")
 		sb.WriteString(strconv.FormatInt(sq.limit, 10))
@@ -438,10 +324,21 @@ func (sq *SearchQuery) selectQuery() string {
 		sb.WriteString(" OFFSET ")
 		sb.WriteString(strconv.FormatInt(sq.offset, 10))
 	}
-	sb.Write(bytes.Join(sq.facet, []byte(" ")))
+	option, err := sq.optionSQL()
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString(option)
+	if !sq.count {
+		facets, err := sq.facetSQL()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(facets)
+	}
 	sb.WriteString(";")
-	if sq.meta {
+	if !sq.count && !sq.noCount {
 		sb.WriteString("SHOW META;")
 	}
-	return sb.String()
+	return sb.String(), nil
 }
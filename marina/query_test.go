@@ -0,0 +1,76 @@
+package marina
+
+import "testing"
+
+type updateProduct struct {
+	ID    int64
+	Title string
+	Brand string `marina:"brand,text,attribute"`
+	Price float64
+}
+
+func TestUpdateQuery(t *testing.T) {
+	m := &marinaClient{}
+	tests := []struct {
+		name    string
+		query   *Query
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "attributes",
+			query: m.NewUpdate().Index("products").Set("price", 9.5).Set("active", false).Filter(Eq("id", 1)),
+			want:  "UPDATE products SET `price` = 9.5, `active` = false WHERE `id` = 1;",
+		},
+		{
+			name:  "mva and json",
+			query: m.NewUpdate().Index("products").Set("categories", []uint32{1, 2}).Set("attrs", map[string]int{"size": 42}).Filter(In("id", []int{1, 2})),
+			want:  "UPDATE products SET `categories` = (1,2), `attrs` = '{\"size\":42}' WHERE `id` IN (1,2);",
+		},
+		{
+			name:  "json key",
+			query: m.NewUpdate().Index("products").Set("attrs.size", 43).Filter(Gt("price", 10)),
+			want:  "UPDATE products SET attrs.size = 43 WHERE `price` > 10;",
+		},
+		{
+			name:  "model attributes",
+			query: m.NewUpdate().Index("products").Model(updateProduct{ID: 1, Title: "tv", Brand: "acme", Price: 9.5}).Filter(Eq("id", 1)),
+			want:  "UPDATE products SET brand = 'acme', price = 9.5 WHERE `id` = 1;",
+		},
+		{name: "model without attributes", query: m.NewUpdate().Index("products").Model(bulkProduct{ID: 1, Title: "tv"}).Filter(Eq("id", 1)), wantErr: true},
+		{name: "no filter", query: m.NewUpdate().Index("products").Set("price", 1), wantErr: true},
+		{name: "no values", query: m.NewUpdate().Index("products").Filter(Eq("id", 1)), wantErr: true},
+		{name: "invalid column", query: m.NewUpdate().Index("products").Set("price`", 1).Filter(Eq("id", 1)), wantErr: true},
+		{name: "delete without filter", query: m.NewDelete().Index("products"), wantErr: true},
+		{
+			name:  "delete by filter",
+			query: m.NewDelete().Index("products").Filter(Or(Lt("price", 1), Any("categories", "=", 3))),
+			want:  "DELETE FROM products WHERE `price` < 1 OR ANY(`categories`) = 3;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.Query()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Query() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexQuery(t *testing.T) {
+	m := &marinaClient{}
+	if _, err := m.NewCreate().Index("products").Options(DefaultTableOptions()).Query(); err == nil {
+		t.Error("Query() without model must fail")
+	}
+	got, err := m.NewCreate().Index("products").Model(bulkProduct{}).Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TABLE products (title text indexed) dict='keywords' index_exact_words='1' min_infix_len='2'"; got != want {
+		t.Errorf("Query() = %s, want %s", got, want)
+	}
+}
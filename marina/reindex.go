@@ -0,0 +1,322 @@
+package marina
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	reindexTable    = "marina_reindex"
+	reindexBuilding = "building"
+)
+
+var versionRE = regexp.MustCompile(`_v(\d+)$`)
+
+// ReindexBatch indexes models of a source batch, models are structs with an integer ID
+type ReindexBatch func(models ...any) error
+
+// Reindex rebuilds the table behind an alias without downtime: documents are indexed into a new
+// versioned table alias_vN, then the alias distributed table is pointed to it and older versions are dropped.
+// Searches use the alias, writes go to the table returned by ResolveIndex.
+type Reindex struct {
+	// Alias name searches use
+	Alias  string
+	Schema *Schema
+	// Source calls batch with documents ordered by ID ascending starting after afterID,
+	// afterID is not 0 when an interrupted reindex is resumed
+	Source func(ctx context.Context, afterID int64, batch ReindexBatch) error
+	// Expected returns the number of source documents the new table must have, the check is skipped when nil
+	Expected func(ctx context.Context) (int64, error)
+	// KeepOld keeps previous versions instead of dropping them
+	KeepOld bool
+}
+
+// ReindexResult built table and the number of documents in it
+type ReindexResult struct {
+	Table   string
+	Count   int64
+	Resumed bool
+	Dropped []string
+}
+
+type reindexState struct {
+	target  string
+	lastID  int64
+	indexed int64
+}
+
+// Reindex runs reindex, progress is saved after every batch, so calling it again after a crash
+// continues the interrupted build from the last indexed document
+func (m *marinaClient) Reindex(ctx context.Context, reindex Reindex) (*ReindexResult, error) {
+	if _, err := QuoteIdentifier(reindex.Alias); err != nil || strings.Contains(reindex.Alias, ".") {
+		return nil, fmt.Errorf("invalid alias %q", reindex.Alias)
+	}
+	if reindex.Schema == nil || reindex.Source == nil {
+		return nil, errors.New("reindex schema and source are required")
+	}
+	if _, err := m.Conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+reindexTable+
+		" (alias string, target string, last_id bigint, indexed bigint, status string)"); err != nil {
+		return nil, fmt.Errorf("create reindex state table: %w", err)
+	}
+
+	result := &ReindexResult{}
+	state, err := m.loadReindexState(ctx, reindex.Alias)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		result.Resumed = true
+	} else {
+		if state, err = m.startReindex(ctx, reindex); err != nil {
+			return nil, err
+		}
+	}
+	result.Table = state.target
+
+	err = reindex.Source(ctx, state.lastID, func(models ...any) error {
+		if len(models) == 0 {
+			return nil
+		}
+		lastID := state.lastID
+		for _, model := range models {
+			id, err := documentID(model)
+			if err != nil {
+				return err
+			}
+			lastID = max(lastID, id)
+		}
+		if err := m.NewBulkUpsert().Index(state.target).Model(models...).Exec(ctx); err != nil {
+			return fmt.Errorf("index batch after %d: %w", state.lastID, err)
+		}
+		state.lastID = lastID
+		state.indexed += int64(len(models))
+		return m.saveReindexState(ctx, reindex.Alias, state)
+	})
+	if err != nil {
+		return result, fmt.Errorf("reindex %s: %w", reindex.Alias, err)
+	}
+
+	if result.Count, err = m.count(ctx, state.target); err != nil {
+		return result, err
+	}
+	if reindex.Expected != nil {
+		expected, err := reindex.Expected(ctx)
+		if err != nil {
+			return result, err
+		}
+		if expected != result.Count {
+			return result, fmt.Errorf("reindex %s: %s has %d documents, expected %d", reindex.Alias, state.target, result.Count, expected)
+		}
+	}
+
+	if err = m.Optimize(ctx, state.target); err != nil {
+		return result, fmt.Errorf("optimize %s: %w", state.target, err)
+	}
+	old, err := m.switchAlias(ctx, reindex.Alias, state.target)
+	if err != nil {
+		return result, err
+	}
+	if !reindex.KeepOld {
+		for _, table := range old {
+			if _, err = m.Conn.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				return result, fmt.Errorf("drop %s: %w", table, err)
+			}
+			result.Dropped = append(result.Dropped, table)
+		}
+	}
+	if _, err = m.Conn.ExecContext(ctx, "DELETE FROM "+reindexTable+" WHERE id = "+reindexStateID(reindex.Alias)); err != nil {
+		return result, fmt.Errorf("delete reindex state: %w", err)
+	}
+	return result, nil
+}
+
+// ResolveIndex returns the table behind alias, the alias itself when it is a plain table.
+// During a rebuild it returns the old table: Source reads documents once in ID order, so writes to
+// the old table for documents the build has already passed never reach the new table. Pause writes
+// or replay them after Reindex returns.
+func (m *marinaClient) ResolveIndex(ctx context.Context, alias string) (string, error) {
+	tables, distributed, err := m.aliasTables(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	if !distributed || len(tables) == 0 {
+		return alias, nil
+	}
+	return tables[len(tables)-1], nil
+}
+
+// startReindex creates the next version table
+func (m *marinaClient) startReindex(ctx context.Context, reindex Reindex) (*reindexState, error) {
+	tables, _, err := m.aliasTables(ctx, reindex.Alias)
+	if err != nil {
+		return nil, err
+	}
+	version := 0
+	for _, table := range tables {
+		if match := versionRE.FindStringSubmatch(table); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			version = max(version, n)
+		}
+	}
+	state := &reindexState{target: reindex.Alias + "_v" + strconv.Itoa(version+1)}
+	// a leftover of a build which failed before its state was saved
+	if _, err = m.Conn.ExecContext(ctx, "DROP TABLE IF EXISTS "+state.target); err != nil {
+		return nil, err
+	}
+	if _, err = m.Conn.ExecContext(ctx, reindex.Schema.createSQL(state.target)); err != nil {
+		return nil, fmt.Errorf("create %s: %w", state.target, err)
+	}
+	if err = m.saveReindexState(ctx, reindex.Alias, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// aliasTables returns local tables of the alias distributed table or the alias when it is a plain table
+func (m *marinaClient) aliasTables(ctx context.Context, alias string) ([]string, bool, error) {
+	rows, err := m.Conn.QueryContext(ctx, "SHOW TABLES LIKE "+QuoteString(alias))
+	if err != nil {
+		return nil, false, err
+	}
+	tableType := ""
+	for rows.Next() {
+		var name, kind string
+		if err = rows.Scan(&name, &kind); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		if name == alias {
+			tableType = kind
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+	switch tableType {
+	case "":
+		return nil, false, nil
+	case "distributed":
+	default:
+		return []string{alias}, false, nil
+	}
+
+	rows, err = m.Conn.QueryContext(ctx, "DESCRIBE "+alias)
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+	tables := make([]string, 0, 1)
+	for rows.Next() {
+		var agent, kind string
+		if err = rows.Scan(&agent, &kind); err != nil {
+			return nil, true, err
+		}
+		if kind == "local" {
+			tables = append(tables, agent)
+		}
+	}
+	return tables, true, rows.Err()
+}
+
+// switchAlias points alias to target and returns tables it pointed to before. The alias distributed
+// table is altered in place, so searches keep working during the switch. On the first run the alias is
+// a plain table or missing, then it is replaced by a distributed table.
+func (m *marinaClient) switchAlias(ctx context.Context, alias, target string) ([]string, error) {
+	tables, distributed, err := m.aliasTables(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	if !distributed {
+		// a plain table named as the alias is dropped by the recreation, so it is not dropped again
+		statements := []string{
+			"DROP TABLE IF EXISTS " + alias,
+			"CREATE TABLE " + alias + " type='distributed' local=" + QuoteString(target),
+		}
+		for _, statement := range statements {
+			if _, err = m.Conn.ExecContext(ctx, statement); err != nil {
+				return nil, fmt.Errorf("switch %s to %s: %w", alias, target, err)
+			}
+		}
+		return nil, nil
+	}
+	old := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if table != target {
+			old = append(old, table)
+		}
+	}
+	if _, err = m.Conn.ExecContext(ctx, "ALTER TABLE "+alias+" local="+QuoteString(target)); err != nil {
+		return nil, fmt.Errorf("switch %s to %s: %w", alias, target, err)
+	}
+	return old, nil
+}
+
+func (m *marinaClient) count(ctx context.Context, table string) (int64, error) {
+	rows, err := m.Conn.QueryContext(ctx, "SELECT COUNT(*) FROM "+table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	return getCount(rows)
+}
+
+func (m *marinaClient) loadReindexState(ctx context.Context, alias string) (*reindexState, error) {
+	rows, err := m.Conn.QueryContext(ctx, "SELECT target, last_id, indexed FROM "+reindexTable+
+		" WHERE id = "+reindexStateID(alias)+" AND status = "+QuoteString(reindexBuilding))
+	if err != nil {
+		return nil, fmt.Errorf("load reindex state: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	state := &reindexState{}
+	if err = rows.Scan(&state.target, &state.lastID, &state.indexed); err != nil {
+		return nil, fmt.Errorf("load reindex state: %w", err)
+	}
+	return state, nil
+}
+
+func (m *marinaClient) saveReindexState(ctx context.Context, alias string, state *reindexState) error {
+	_, err := m.Conn.ExecContext(ctx, fmt.Sprintf("REPLACE INTO %s (id, alias, target, last_id, indexed, status) VALUES (%s, %s, %s, %d, %d, %s)",
+		reindexTable, reindexStateID(alias), QuoteString(alias), QuoteString(state.target), state.lastID, state.indexed, QuoteString(reindexBuilding)))
+	if err != nil {
+		return fmt.Errorf("save reindex state: %w", err)
+	}
+	return nil
+}
+
+// reindexStateID document id of alias state, ids are positive
+func reindexStateID(alias string) string {
+	h := fnv.New64a()
+	h.Write([]byte(alias))
+	return strconv.FormatUint(h.Sum64()>>1, 10)
+}
+
+// documentID returns the integer value of the model column id
+func documentID(model any) (int64, error) {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	if v.Kind() != reflect.Struct {
+		return 0, errors.New("object is not a struct")
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if name, ok := columnName(v.Type().Field(i)); !ok || name != "id" {
+			continue
+		}
+		switch field := v.Field(i); field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return field.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(field.Uint()), nil
+		}
+		return 0, fmt.Errorf("%s id is not an integer", v.Type())
+	}
+	return 0, fmt.Errorf("%s has no id", v.Type())
+}
@@ -0,0 +1,268 @@
+package marina
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDocumentID(t *testing.T) {
+	type tagged struct {
+		Key uint32 `marina:"id"`
+	}
+	tests := []struct {
+		name    string
+		model   any
+		want    int64
+		wantErr bool
+	}{
+		{name: "id field", model: scanProduct{ID: 7}, want: 7},
+		{name: "pointer", model: &scanProduct{ID: 8}, want: 8},
+		{name: "tagged", model: tagged{Key: 9}, want: 9},
+		{name: "string id", model: struct{ ID string }{ID: "1"}, wantErr: true},
+		{name: "no id", model: struct{ Title string }{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := documentID(tt.model)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("documentID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("documentID() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeConnector records statements and answers queries with canned rows, it stands in for Manticore
+type fakeConnector struct {
+	mu         sync.Mutex
+	statements []string
+	// rows returns columns and text protocol rows of a query
+	rows func(query string) ([]string, [][]string)
+	// results returns result sets of a multi-statement query, rows is used when it is nil
+	results func(query string) []fakeResult
+}
+
+// fakeResult result set of a query
+type fakeResult struct {
+	columns []string
+	rows    [][]string
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+func (c *fakeConnector) record(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, query)
+}
+
+type fakeConn struct{ c *fakeConnector }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (f fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	f.c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (f fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	f.c.record(query)
+	if f.c.results != nil {
+		return &fakeRows{results: f.c.results(query)}, nil
+	}
+	columns, rows := f.c.rows(query)
+	return &fakeRows{results: []fakeResult{{columns: columns, rows: rows}}}, nil
+}
+
+type fakeRows struct {
+	results []fakeResult
+}
+
+func (r *fakeRows) Columns() []string { return r.results[0].columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	result := &r.results[0]
+	if len(result.rows) == 0 {
+		return io.EOF
+	}
+	for i, value := range result.rows[0] {
+		dest[i] = []byte(value)
+	}
+	result.rows = result.rows[1:]
+	return nil
+}
+
+func (r *fakeRows) HasNextResultSet() bool { return len(r.results) > 1 }
+
+func (r *fakeRows) NextResultSet() error {
+	if len(r.results) < 2 {
+		return io.EOF
+	}
+	r.results = r.results[1:]
+	return nil
+}
+
+// fakeManticore answers reindex queries: tables are SHOW TABLES rows, locals are agents of the alias,
+// state is the saved reindex row and count is the number of documents of every table
+func fakeManticore(tables [][]string, locals []string, state []string, count string) *fakeConnector {
+	return &fakeConnector{rows: func(query string) ([]string, [][]string) {
+		switch {
+		case strings.HasPrefix(query, "SHOW TABLES"):
+			return []string{"Index", "Type"}, tables
+		case strings.HasPrefix(query, "DESCRIBE"):
+			rows := make([][]string, 0, len(locals))
+			for _, local := range locals {
+				rows = append(rows, []string{local, "local"})
+			}
+			return []string{"Agent", "Type"}, rows
+		case strings.HasPrefix(query, "SELECT target"):
+			if state == nil {
+				return []string{"target", "last_id", "indexed"}, nil
+			}
+			return []string{"target", "last_id", "indexed"}, [][]string{state}
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return []string{"count(*)"}, [][]string{{count}}
+		}
+		return nil, nil
+	}}
+}
+
+func TestReindex(t *testing.T) {
+	stateID := reindexStateID("products")
+	schema, err := SchemaOf(bulkProduct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		tables      [][]string
+		locals      []string
+		state       []string
+		count       string
+		expected    int64
+		wantAfterID int64
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:   "first run replaces plain table",
+			tables: [][]string{{"products", "rt"}},
+			count:  "2",
+			want: []string{
+				"SHOW TABLES LIKE 'products'",
+				"DROP TABLE IF EXISTS products_v1",
+				"CREATE TABLE products_v1 (title text indexed) dict='keywords' index_exact_words='1' min_infix_len='2'",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v1', 0, 0, 'building')",
+				"REPLACE INTO products_v1(id, title) VALUES(1, 'a'), (2, 'b');",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v1', 2, 2, 'building')",
+				"SELECT COUNT(*) FROM products_v1",
+				"OPTIMIZE INDEX products_v1",
+				"SHOW TABLES LIKE 'products'",
+				"DROP TABLE IF EXISTS products",
+				"CREATE TABLE products type='distributed' local='products_v1'",
+				"DELETE FROM marina_reindex WHERE id = " + stateID,
+			},
+		},
+		{
+			name:   "next version alters alias",
+			tables: [][]string{{"products", "distributed"}},
+			locals: []string{"products_v3"},
+			count:  "2",
+			want: []string{
+				"SHOW TABLES LIKE 'products'",
+				"DESCRIBE products",
+				"DROP TABLE IF EXISTS products_v4",
+				"CREATE TABLE products_v4 (title text indexed) dict='keywords' index_exact_words='1' min_infix_len='2'",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v4', 0, 0, 'building')",
+				"REPLACE INTO products_v4(id, title) VALUES(1, 'a'), (2, 'b');",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v4', 2, 2, 'building')",
+				"SELECT COUNT(*) FROM products_v4",
+				"OPTIMIZE INDEX products_v4",
+				"SHOW TABLES LIKE 'products'",
+				"DESCRIBE products",
+				"ALTER TABLE products local='products_v4'",
+				"DROP TABLE IF EXISTS products_v3",
+				"DELETE FROM marina_reindex WHERE id = " + stateID,
+			},
+		},
+		{
+			name:        "resume",
+			tables:      [][]string{{"products", "distributed"}},
+			locals:      []string{"products_v1"},
+			state:       []string{"products_v2", "1", "1"},
+			count:       "3",
+			wantAfterID: 1,
+			want: []string{
+				"REPLACE INTO products_v2(id, title) VALUES(1, 'a'), (2, 'b');",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v2', 2, 3, 'building')",
+				"SELECT COUNT(*) FROM products_v2",
+				"OPTIMIZE INDEX products_v2",
+				"SHOW TABLES LIKE 'products'",
+				"DESCRIBE products",
+				"ALTER TABLE products local='products_v2'",
+				"DROP TABLE IF EXISTS products_v1",
+				"DELETE FROM marina_reindex WHERE id = " + stateID,
+			},
+		},
+		{
+			name:     "count mismatch keeps alias",
+			tables:   [][]string{{"products", "distributed"}},
+			locals:   []string{"products_v1"},
+			count:    "1",
+			expected: 2,
+			want: []string{
+				"SHOW TABLES LIKE 'products'",
+				"DESCRIBE products",
+				"DROP TABLE IF EXISTS products_v2",
+				"CREATE TABLE products_v2 (title text indexed) dict='keywords' index_exact_words='1' min_infix_len='2'",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v2', 0, 0, 'building')",
+				"REPLACE INTO products_v2(id, title) VALUES(1, 'a'), (2, 'b');",
+				"REPLACE INTO marina_reindex (id, alias, target, last_id, indexed, status) VALUES (" + stateID + ", 'products', 'products_v2', 2, 2, 'building')",
+				"SELECT COUNT(*) FROM products_v2",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := fakeManticore(tt.tables, tt.locals, tt.state, tt.count)
+			m := &marinaClient{Conn: sqlx.NewDb(sql.OpenDB(connector), "mysql")}
+			defer m.Close()
+			reindex := Reindex{
+				Alias:  "products",
+				Schema: schema,
+				Source: func(ctx context.Context, afterID int64, batch ReindexBatch) error {
+					if afterID != tt.wantAfterID {
+						t.Errorf("Source() afterID = %d, want %d", afterID, tt.wantAfterID)
+					}
+					return batch(bulkProduct{ID: 1, Title: "a"}, bulkProduct{ID: 2, Title: "b"})
+				},
+			}
+			if tt.expected > 0 {
+				reindex.Expected = func(context.Context) (int64, error) { return tt.expected, nil }
+			}
+			_, err := m.Reindex(context.Background(), reindex)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reindex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// the first statements create the state table and load the state
+			got := connector.statements[2:]
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Reindex() statements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package marina
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	weightColumn    = "_weight"
+	highlightPrefix = "_highlight_"
+)
+
+// Hit found document with its full-text weight and highlighted fields
+type Hit[T any] struct {
+	ID         int64
+	Document   T
+	Weight     int64
+	Highlights map[string]string
+}
+
+// Meta SHOW META statistics of a search
+type Meta struct {
+	Total      int64
+	TotalFound int64
+	Time       time.Duration
+	Warning    string
+	// Values all SHOW META variables, e.g. keyword[0], docs[0], hits[0]
+	Values map[string]string
+}
+
+// TypedResult result of ScanInto
+type TypedResult[T any] struct {
+	Hits   []*Hit[T]
+	Facets FacetResult
+	Meta   Meta
+}
+
+// Documents returns found documents in search order
+func (r *TypedResult[T]) Documents() []T {
+	documents := make([]T, 0, len(r.Hits))
+	for _, hit := range r.Hits {
+		documents = append(documents, hit.Document)
+	}
+	return documents
+}
+
+// Columns selects fields returned by ScanInto, all stored fields by default
+func (sq *SearchQuery) Columns(fields ...string) *SearchQuery {
+	sq.columns = append(sq.columns, fields...)
+	return sq
+}
+
+// Highlight returns highlighted snippets of the full-text fields by ScanInto
+func (sq *SearchQuery) Highlight(fields ...string) *SearchQuery {
+	sq.highlights = append(sq.highlights, fields...)
+	return sq
+}
+
+// selectColumns renders the select list of ScanInto
+func (sq *SearchQuery) selectColumns() (string, error) {
+	columns := []string{"*"}
+	if len(sq.columns) > 0 {
+		columns = []string{"id"}
+		for _, column := range sq.columns {
+			if column == "id" {
+				continue
+			}
+			quoted, err := QuoteIdentifier(column)
+			if err != nil {
+				return "", err
+			}
+			columns = append(columns, quoted)
+		}
+	}
+	if len(sq.match) > 0 || len(sq.matchOr) > 0 {
+		columns = append(columns, "WEIGHT() AS "+weightColumn)
+	}
+	for _, field := range sq.highlights {
+		// highlights are of full-text fields, a JSON path would not be a valid alias
+		if _, err := QuoteIdentifier(field); err != nil || strings.Contains(field, ".") {
+			return "", fmt.Errorf("invalid highlight field %q", field)
+		}
+		alias, err := QuoteIdentifier(highlightPrefix + field)
+		if err != nil {
+			return "", err
+		}
+		columns = append(columns, "HIGHLIGHT({}, "+QuoteString(field)+") AS "+alias)
+	}
+	return strings.Join(columns, ", "), nil
+}
+
+// ScanInto searches documents and maps their columns into T fields by snake_case names,
+// the same naming Query.Model uses for inserts. T is a struct, not a pointer.
+func ScanInto[T any](ctx context.Context, sq *SearchQuery) (*TypedResult[T], error) {
+	if sq.err != nil {
+		return nil, sq.err
+	}
+	sq.scan = true
+	defer func() {
+		sq.scan = false
+	}()
+	rows, err := sq.search(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &TypedResult[T]{Hits: make([]*Hit[T], 0)}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	fields, err := columnFields(reflect.TypeOf((*T)(nil)).Elem(), columns)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		hit, err := scanHit[T](rows, columns, fields)
+		if err != nil {
+			return nil, err
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	facets, err := getFacets(rows, sq.facets)
+	if err != nil {
+		return nil, err
+	}
+	result.Facets = facetResult(facets)
+	if result.Meta, err = sq.readMeta(rows); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// columnFields returns struct field index of every column, nil for columns without a field
+func columnFields(t reflect.Type, columns []string) ([][]int, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("scan into %s: not a struct", t)
+	}
+	byName := make(map[string][]int, t.NumField())
+	for _, field := range reflect.VisibleFields(t) {
+		if name, ok := columnName(field); ok && field.IsExported() && !field.Anonymous {
+			byName[name] = field.Index
+		}
+	}
+	fields := make([][]int, len(columns))
+	for i, column := range columns {
+		fields[i] = byName[column]
+	}
+	return fields, nil
+}
+
+func scanHit[T any](rows *sql.Rows, columns []string, fields [][]int) (*Hit[T], error) {
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	hit := &Hit[T]{}
+	document := reflect.ValueOf(&hit.Document).Elem()
+	for i, column := range columns {
+		value := values[i]
+		switch {
+		case column == "id":
+			id, err := strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("scan id: %w", err)
+			}
+			hit.ID = id
+		case column == weightColumn:
+			weight, err := strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("scan weight: %w", err)
+			}
+			hit.Weight = weight
+			continue
+		case strings.HasPrefix(column, highlightPrefix):
+			if hit.Highlights == nil {
+				hit.Highlights = make(map[string]string)
+			}
+			hit.Highlights[strings.TrimPrefix(column, highlightPrefix)] = string(value)
+			continue
+		}
+		if fields[i] == nil || value == nil {
+			continue
+		}
+		if err := setColumnValue(document.FieldByIndex(fields[i]), value); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", column, err)
+		}
+	}
+	return hit, nil
+}
+
+// setColumnValue converts text protocol value: MVA are comma separated, timestamps are unix seconds,
+// string lists are space separated as Query.Model stores them, other types are JSON attributes
+func setColumnValue(field reflect.Value, value []byte) error {
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		seconds, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(time.Unix(seconds, 0)))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(field.Type().Elem())
+		if err := setColumnValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	case reflect.String:
+		field.SetString(string(value))
+		return nil
+	case reflect.Slice:
+		switch field.Type().Elem().Kind() {
+		case reflect.String:
+			field.Set(reflect.ValueOf(strings.Fields(string(value))).Convert(field.Type()))
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			parts := strings.FieldsFunc(string(value), func(r rune) bool { return r == ',' })
+			slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+			for i, part := range parts {
+				if err := setColumnValue(slice.Index(i), []byte(part)); err != nil {
+					return err
+				}
+			}
+			field.Set(slice)
+			return nil
+		}
+	}
+	if err := setScalar(field, string(value)); err != errUnsupportedKind {
+		return err
+	}
+	return json.Unmarshal(value, field.Addr().Interface())
+}
+
+var errUnsupportedKind = errors.New("unsupported kind")
+
+func setScalar(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.Bool:
+		field.SetBool(value == "1" || value == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(v)
+	default:
+		return errUnsupportedKind
+	}
+	return nil
+}
+
+// scanMeta reads SHOW META result set
+func scanMeta(rows *sql.Rows) (Meta, error) {
+	meta := Meta{Values: make(map[string]string)}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return meta, err
+		}
+		meta.Values[name] = value
+	}
+	meta.Total, _ = strconv.ParseInt(meta.Values["total"], 10, 64)
+	meta.TotalFound, _ = strconv.ParseInt(meta.Values["total_found"], 10, 64)
+	meta.Warning = meta.Values["warning"]
+	if seconds, err := strconv.ParseFloat(meta.Values["time"], 64); err == nil {
+		meta.Time = time.Duration(seconds * float64(time.Second))
+	}
+	return meta, rows.Err()
+}
@@ -0,0 +1,78 @@
+package marina
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type scanProduct struct {
+	ID         int64
+	Title      string
+	Tags       []string
+	Categories []uint32
+	Price      float64
+	Active     bool
+	CreatedAt  time.Time
+	Discount   *int
+	Attrs      map[string]any
+}
+
+func TestSetColumnValue(t *testing.T) {
+	discount := 5
+	tests := []struct {
+		name   string
+		column string
+		value  string
+		want   any
+	}{
+		{name: "bigint id", column: "id", value: "9007199254740993", want: int64(9007199254740993)},
+		{name: "string", column: "title", value: "it's", want: "it's"},
+		{name: "string list", column: "tags", value: "red blue", want: []string{"red", "blue"}},
+		{name: "mva", column: "categories", value: "1,2,3", want: []uint32{1, 2, 3}},
+		{name: "empty mva", column: "categories", value: "", want: []uint32{}},
+		{name: "float", column: "price", value: "9.99", want: 9.99},
+		{name: "bool", column: "active", value: "1", want: true},
+		{name: "timestamp", column: "created_at", value: "1700000000", want: time.Unix(1700000000, 0)},
+		{name: "pointer", column: "discount", value: "5", want: &discount},
+		{name: "json", column: "attrs", value: `{"color":"red"}`, want: map[string]any{"color": "red"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := columnFields(reflect.TypeOf(scanProduct{}), []string{tt.column})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var product scanProduct
+			field := reflect.ValueOf(&product).Elem().FieldByIndex(fields[0])
+			if err = setColumnValue(field, []byte(tt.value)); err != nil {
+				t.Fatal(err)
+			}
+			if got := field.Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setColumnValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	sq := (&marinaClient{}).NewSearch().Index("products").Columns("title", "order").Highlight("title").Match("tv")
+	sq.scan = true
+	got, err := sq.selectQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT id, `title`, `order`, WEIGHT() AS _weight, HIGHLIGHT({}, 'title') AS `_highlight_title` " +
+		"FROM products WHERE MATCH('^tv*');SHOW META;"
+	if got != want {
+		t.Errorf("selectQuery() = %s, want %s", got, want)
+	}
+
+	for _, field := range []string{"meta.title", "title`", "title) AS x, id", ""} {
+		sq = (&marinaClient{}).NewSearch().Index("products").Highlight(field)
+		sq.scan = true
+		if _, err = sq.selectQuery(); err == nil {
+			t.Errorf("selectQuery() with highlight %q error = nil", field)
+		}
+	}
+}
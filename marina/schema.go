@@ -0,0 +1,557 @@
+package marina
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ettle/strcase"
+	"github.com/go-sql-driver/mysql"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types of Manticore real-time tables
+const (
+	ColumnText        = "text"
+	ColumnString      = "string"
+	ColumnJSON        = "json"
+	ColumnTimestamp   = "timestamp"
+	ColumnBool        = "bool"
+	ColumnInt         = "int"
+	ColumnBigint      = "bigint"
+	ColumnFloat       = "float"
+	ColumnMulti       = "multi"
+	ColumnMulti64     = "multi64"
+	ColumnFloatVector = "float_vector"
+)
+
+const schemaTag = "marina"
+
+var columnTypes = map[string]bool{
+	ColumnText:        true,
+	ColumnString:      true,
+	ColumnJSON:        true,
+	ColumnTimestamp:   true,
+	ColumnBool:        true,
+	ColumnInt:         true,
+	ColumnBigint:      true,
+	ColumnFloat:       true,
+	ColumnMulti:       true,
+	ColumnMulti64:     true,
+	ColumnFloatVector: true,
+}
+
+// Column table column, declared by struct tag:
+//
+//	Title  string    `marina:"title,text,indexed,stored,infix"`
+//	Brand  string    `marina:",string"`
+//	Attrs  any       `marina:",json"`
+//	Vector []float32 `marina:",float_vector,knn_dims=128,hnsw_similarity=cosine"`
+//	Secret string    `marina:"-"`
+//
+// The name defaults to snake_case field name and the type to the one of Go type.
+// Text options: indexed (the default, tag stored as well to keep the original text), stored,
+// attribute (also a string attribute), prefix, infix (prefix_fields/infix_fields) and
+// nomorph (morphology_skip_fields).
+type Column struct {
+	Name      string
+	Type      string
+	Indexed   bool
+	Stored    bool
+	Attribute bool
+	Prefix    bool
+	Infix     bool
+	NoMorph   bool
+	// Knn float_vector options, e.g. knn_dims=128 hnsw_similarity=l2
+	Knn map[string]string
+}
+
+func (c Column) sql() string {
+	sb := strings.Builder{}
+	sb.WriteString(c.Name + " " + c.Type)
+	switch c.Type {
+	case ColumnText:
+		if c.Indexed {
+			sb.WriteString(" indexed")
+		}
+		if c.Stored {
+			sb.WriteString(" stored")
+		}
+		if c.Attribute {
+			sb.WriteString(" attribute")
+		}
+	case ColumnFloatVector:
+		knn := map[string]string{"knn_type": "hnsw", "hnsw_similarity": "l2"}
+		for key, value := range c.Knn {
+			knn[key] = value
+		}
+		keys := make([]string, 0, len(knn))
+		for key := range knn {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sb.WriteString(" " + key + "=" + QuoteString(knn[key]))
+		}
+	}
+	return sb.String()
+}
+
+// textProperties returns text field properties compared with the table: indexed, stored and
+// prefix, infix, nomorph of prefix_fields, infix_fields and morphology_skip_fields
+func (c Column) textProperties() []string {
+	if c.Type != ColumnText {
+		return nil
+	}
+	properties := make([]string, 0, 5)
+	for _, p := range []struct {
+		name string
+		set  bool
+	}{{"indexed", c.Indexed}, {"stored", c.Stored}, {"prefix", c.Prefix}, {"infix", c.Infix}, {"nomorph", c.NoMorph}} {
+		if p.set {
+			properties = append(properties, p.name)
+		}
+	}
+	return properties
+}
+
+// updatable reports UPDATE can set the column, full-text fields without string attribute can not be updated
+func (c Column) updatable() bool {
+	return c.Type != ColumnText || c.Attribute
+}
+
+// describeTypes returns types of DESCRIBE rows of the column, text attribute is an extra string row
+func (c Column) describeTypes() []string {
+	switch c.Type {
+	case ColumnInt:
+		return []string{"uint"}
+	case ColumnMulti:
+		return []string{"mva"}
+	case ColumnMulti64:
+		return []string{"mva64"}
+	case ColumnText:
+		if c.Attribute {
+			return []string{ColumnText, ColumnString}
+		}
+	}
+	return []string{c.Type}
+}
+
+// TableOptions CREATE TABLE settings
+type TableOptions struct {
+	Dict            string
+	Morphology      string
+	CharsetTable    string
+	Stopwords       string
+	HTMLStrip       bool
+	IndexExactWords bool
+	MinInfixLen     int
+	MinPrefixLen    int
+	// Extra other settings, e.g. blend_chars
+	Extra map[string]string
+}
+
+// DefaultTableOptions options tables were always created with
+func DefaultTableOptions() TableOptions {
+	return TableOptions{
+		Dict:            "keywords",
+		IndexExactWords: true,
+		MinInfixLen:     2,
+	}
+}
+
+func (o TableOptions) settings(columns []Column) map[string]string {
+	settings := make(map[string]string)
+	set := func(key, value string) {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+	set("dict", o.Dict)
+	set("morphology", o.Morphology)
+	set("charset_table", o.CharsetTable)
+	set("stopwords", o.Stopwords)
+	if o.HTMLStrip {
+		settings["html_strip"] = "1"
+	}
+	if o.IndexExactWords {
+		settings["index_exact_words"] = "1"
+	}
+	if o.MinInfixLen > 0 {
+		settings["min_infix_len"] = strconv.Itoa(o.MinInfixLen)
+	}
+	if o.MinPrefixLen > 0 {
+		settings["min_prefix_len"] = strconv.Itoa(o.MinPrefixLen)
+	}
+	var prefix, infix, noMorph []string
+	for _, column := range columns {
+		if column.Prefix {
+			prefix = append(prefix, column.Name)
+		}
+		if column.Infix {
+			infix = append(infix, column.Name)
+		}
+		if column.NoMorph {
+			noMorph = append(noMorph, column.Name)
+		}
+	}
+	set("prefix_fields", strings.Join(prefix, ","))
+	set("infix_fields", strings.Join(infix, ","))
+	set("morphology_skip_fields", strings.Join(noMorph, ","))
+	for key, value := range o.Extra {
+		settings[key] = value
+	}
+	return settings
+}
+
+// Schema table columns and options
+type Schema struct {
+	Columns []Column
+	Options TableOptions
+}
+
+// SchemaOf builds schema of model struct with default table options
+func SchemaOf(model any) (*Schema, error) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("object is not a struct")
+	}
+	schema := &Schema{Options: DefaultTableOptions()}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		column, ok, err := parseColumn(field)
+		if err != nil {
+			return nil, err
+		}
+		// id is the document id column of every table
+		if ok && column.Name != "id" {
+			schema.Columns = append(schema.Columns, column)
+		}
+	}
+	return schema, nil
+}
+
+func parseColumn(field reflect.StructField) (Column, bool, error) {
+	name, ok := columnName(field)
+	if !ok {
+		return Column{}, false, nil
+	}
+	column := Column{Name: name, Indexed: true}
+	if _, err := QuoteIdentifier(name); err != nil || strings.Contains(name, ".") {
+		return column, false, fmt.Errorf("field %s: invalid column name %q", field.Name, name)
+	}
+	parts := strings.Split(field.Tag.Get(schemaTag), ",")
+	if len(parts) > 1 && parts[1] != "" {
+		column.Type = parts[1]
+	} else {
+		column.Type = columnType(field.Type)
+	}
+	if column.Type == "" {
+		return column, false, fmt.Errorf("field %s: unsupported type %s", field.Name, field.Type)
+	}
+	if !columnTypes[column.Type] {
+		return column, false, fmt.Errorf("field %s: unknown column type %q", field.Name, column.Type)
+	}
+
+	options := parts[min(len(parts), 2):]
+	textOptions := false
+	for _, option := range options {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch {
+		case key == "indexed" || key == "stored":
+			if !textOptions {
+				column.Indexed, column.Stored, textOptions = false, false, true
+			}
+			column.Indexed = column.Indexed || key == "indexed"
+			column.Stored = column.Stored || key == "stored"
+		case key == "attribute":
+			column.Attribute = true
+		case key == "prefix":
+			column.Prefix = true
+		case key == "infix":
+			column.Infix = true
+		case key == "nomorph":
+			column.NoMorph = true
+		case strings.HasPrefix(key, "knn_") || strings.HasPrefix(key, "hnsw_"):
+			if column.Knn == nil {
+				column.Knn = make(map[string]string)
+			}
+			column.Knn[key] = value
+		case key == "":
+		default:
+			return column, false, fmt.Errorf("field %s: unknown column option %q", field.Name, key)
+		}
+	}
+	textOnly := textOptions || column.Attribute || column.Prefix || column.Infix || column.NoMorph
+	if textOnly && column.Type != ColumnText {
+		return column, false, fmt.Errorf("field %s: text options on %s column", field.Name, column.Type)
+	}
+	if column.Type == ColumnFloatVector && column.Knn["knn_dims"] == "" {
+		return column, false, fmt.Errorf("field %s: float_vector needs knn_dims", field.Name)
+	}
+	return column, true, nil
+}
+
+// columnType maps Go type to column type the same way Query.Model renders values
+func columnType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return ColumnTimestamp
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return columnType(t.Elem())
+	case reflect.String:
+		return ColumnText
+	case reflect.Bool:
+		return ColumnBool
+	case reflect.Int, reflect.Uint, reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16, reflect.Int32, reflect.Uint32:
+		return ColumnInt
+	case reflect.Int64, reflect.Uint64:
+		return ColumnBigint
+	case reflect.Float32, reflect.Float64:
+		return ColumnFloat
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String:
+			return ColumnText
+		case reflect.Int, reflect.Uint, reflect.Int32, reflect.Uint32, reflect.Float32:
+			return ColumnMulti
+		case reflect.Int64, reflect.Uint64, reflect.Float64:
+			return ColumnMulti64
+		}
+		return ColumnJSON
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		return ColumnJSON
+	}
+	return ""
+}
+
+// createSQL renders CREATE TABLE of the schema
+func (s *Schema) createSQL(index string) string {
+	columns := make([]string, 0, len(s.Columns))
+	for _, column := range s.Columns {
+		columns = append(columns, column.sql())
+	}
+	sb := strings.Builder{}
+	sb.WriteString("CREATE TABLE " + index + " (" + strings.Join(columns, ", ") + ")")
+	settings := s.Options.settings(s.Columns)
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(" " + key + "=" + QuoteString(settings[key]))
+	}
+	return sb.String()
+}
+
+// ColumnChange column which type or text properties differ from the model, the table has to be reindexed.
+// From and To are DESCRIBE types followed by text properties, see Column.
+type ColumnChange struct {
+	Name string
+	From []string
+	To   []string
+}
+
+// SchemaDiff difference of table and model, Statements are ALTER TABLE statements which fix it
+type SchemaDiff struct {
+	Create bool
+	Add    []Column
+	// Drop columns missing in the model, they are dropped only with DropUnknown
+	Drop       []string
+	Changed    []ColumnChange
+	Statements []string
+}
+
+// Empty reports the table matches the model
+func (d *SchemaDiff) Empty() bool {
+	return !d.Create && len(d.Add) == 0 && len(d.Drop) == 0 && len(d.Changed) == 0
+}
+
+// SchemaSyncOptions options of SyncSchema
+type SchemaSyncOptions struct {
+	// DryRun only reports the difference
+	DryRun bool
+	// DropUnknown drops columns missing in the model
+	DropUnknown bool
+}
+
+// SyncSchema creates the table of schema or adds and drops its columns with ALTER TABLE.
+// Changed column types can not be altered and are only reported, see Reindex.
+func (m *marinaClient) SyncSchema(ctx context.Context, index string, schema *Schema, options SchemaSyncOptions) (*SchemaDiff, error) {
+	if _, err := QuoteIdentifier(index); err != nil {
+		return nil, err
+	}
+	table, err := m.describe(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffSchema(index, schema, table, options.DropUnknown)
+	if options.DryRun {
+		return diff, nil
+	}
+	for _, statement := range diff.Statements {
+		if _, err = m.Conn.ExecContext(ctx, statement); err != nil {
+			return diff, fmt.Errorf("%s: %w", statement, err)
+		}
+	}
+	return diff, nil
+}
+
+// tableDescription columns and text field settings of an existing table
+type tableDescription struct {
+	// types DESCRIBE types by column name
+	types map[string][]string
+	// properties of text fields by name, e.g. indexed, stored, prefix
+	properties map[string][]string
+}
+
+var fieldsSettingRE = regexp.MustCompile(`(prefix_fields|infix_fields|morphology_skip_fields)='([^']*)'`)
+
+// describe returns columns of the table, nil when there is no table
+func (m *marinaClient) describe(ctx context.Context, index string) (*tableDescription, error) {
+	rows, err := m.Conn.QueryContext(ctx, "DESCRIBE "+index)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && strings.Contains(mysqlErr.Message, "no such") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	table := &tableDescription{types: make(map[string][]string), properties: make(map[string][]string)}
+	for rows.Next() {
+		var name, columnType, properties string
+		if err = rows.Scan(&name, &columnType, &properties); err != nil {
+			return nil, err
+		}
+		table.types[name] = append(table.types[name], columnType)
+		if columnType == ColumnText {
+			table.properties[name] = append(table.properties[name], strings.Fields(properties)...)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settings, err := m.Conn.QueryContext(ctx, "SHOW CREATE TABLE "+index)
+	if err != nil {
+		return nil, err
+	}
+	defer settings.Close()
+	for settings.Next() {
+		var name, create string
+		if err = settings.Scan(&name, &create); err != nil {
+			return nil, err
+		}
+		table.addSettings(create)
+	}
+	return table, settings.Err()
+}
+
+// addSettings adds text properties of fields listed in prefix_fields, infix_fields and morphology_skip_fields
+func (t *tableDescription) addSettings(create string) {
+	properties := map[string]string{"prefix_fields": "prefix", "infix_fields": "infix", "morphology_skip_fields": "nomorph"}
+	for _, match := range fieldsSettingRE.FindAllStringSubmatch(create, -1) {
+		for _, field := range strings.Split(match[2], ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				t.properties[field] = append(t.properties[field], properties[match[1]])
+			}
+		}
+	}
+}
+
+func diffSchema(index string, schema *Schema, table *tableDescription, dropUnknown bool) *SchemaDiff {
+	diff := &SchemaDiff{}
+	if table == nil {
+		diff.Create = true
+		diff.Statements = append(diff.Statements, schema.createSQL(index))
+		return diff
+	}
+	declared := make(map[string]bool, len(schema.Columns))
+	for _, column := range schema.Columns {
+		declared[column.Name] = true
+		types, ok := table.types[column.Name]
+		if !ok {
+			diff.Add = append(diff.Add, column)
+			diff.Statements = append(diff.Statements, "ALTER TABLE "+index+" ADD COLUMN "+column.sql())
+			// ALTER can not add a field to prefix_fields, infix_fields or morphology_skip_fields
+			if column.Prefix || column.Infix || column.NoMorph {
+				diff.Changed = append(diff.Changed, ColumnChange{
+					Name: column.Name,
+					From: column.describeTypes(),
+					To:   append(column.describeTypes(), sortedCopy(column.textProperties())...),
+				})
+			}
+			continue
+		}
+		want := column.describeTypes()
+		properties := table.properties[column.Name]
+		if !sameTypes(types, want) || !sameTypes(properties, column.textProperties()) {
+			diff.Changed = append(diff.Changed, ColumnChange{
+				Name: column.Name,
+				From: append(append([]string(nil), types...), sortedCopy(properties)...),
+				To:   append(want, sortedCopy(column.textProperties())...),
+			})
+		}
+	}
+	names := make([]string, 0, len(table.types))
+	for name := range table.types {
+		if name != "id" && !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	diff.Drop = names
+	if dropUnknown {
+		for _, name := range names {
+			diff.Statements = append(diff.Statements, "ALTER TABLE "+index+" DROP COLUMN "+name)
+		}
+	}
+	return diff
+}
+
+func sortedCopy(values []string) []string {
+	values = append([]string(nil), values...)
+	sort.Strings(values)
+	return values
+}
+
+func sameTypes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// columnName returns column of struct field, false for fields tagged marina:"-"
+func columnName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get(schemaTag)
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return strcase.ToSnake(field.Name), true
+}
@@ -0,0 +1,116 @@
+package marina
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaProduct struct {
+	ID        int64
+	Title     string `marina:",text,indexed,infix,prefix"`
+	Brand     string `marina:"brand_name,string"`
+	Body      string `marina:",text,stored,attribute,nomorph"`
+	Tags      []uint32
+	Attrs     map[string]string `marina:",json"`
+	Vector    []float32         `marina:",float_vector,knn_dims=4,hnsw_similarity=cosine"`
+	Price     float64
+	CreatedAt time.Time
+	Secret    string `marina:"-"`
+	internal  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema, err := SchemaOf(&schemaProduct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE TABLE products (title text indexed, brand_name string, body text stored attribute, tags multi, attrs json, " +
+		"vector float_vector hnsw_similarity='cosine' knn_dims='4' knn_type='hnsw', price float, created_at timestamp) " +
+		"dict='keywords' index_exact_words='1' infix_fields='title' min_infix_len='2' morphology_skip_fields='body' prefix_fields='title'"
+	if got := schema.createSQL("products"); got != want {
+		t.Errorf("createSQL() = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		model any
+	}{
+		{name: "unknown type", model: struct {
+			A string `marina:",varchar"`
+		}{}},
+		{name: "unknown option", model: struct {
+			A string `marina:",text,fast"`
+		}{}},
+		{name: "text option of attribute", model: struct {
+			A int `marina:",,infix"`
+		}{}},
+		{name: "vector without dims", model: struct {
+			A []float32 `marina:",float_vector"`
+		}{}},
+		{name: "unsupported go type", model: struct{ A chan int }{}},
+		{name: "not a struct", model: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SchemaOf(tt.model); err == nil {
+				t.Error("SchemaOf() error = nil")
+			}
+		})
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	schema, err := SchemaOf(schemaProduct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := &tableDescription{types: map[string][]string{
+		"id":         {"bigint"},
+		"title":      {"text"},
+		"brand_name": {"string"},
+		"body":       {"text", "string"},
+		"tags":       {"mva"},
+		"attrs":      {"json"},
+		"vector":     {"float_vector"},
+		"price":      {"uint"},
+		"legacy":     {"string"},
+	}, properties: map[string][]string{
+		"title": {"indexed", "stored"},
+		"body":  {"stored"},
+	}}
+	table.addSettings("CREATE TABLE products (...) infix_fields='title' morphology_skip_fields='body' prefix_fields='title,legacy'")
+	diff := diffSchema("products", schema, table, true)
+	wantChanged := []ColumnChange{
+		{Name: "title", From: []string{"text", "indexed", "infix", "prefix", "stored"}, To: []string{"text", "indexed", "infix", "prefix"}},
+		{Name: "price", From: []string{"uint"}, To: []string{"float"}},
+	}
+	if !reflect.DeepEqual(diff.Changed, wantChanged) {
+		t.Errorf("Changed = %v, want %v", diff.Changed, wantChanged)
+	}
+	want := []string{
+		"ALTER TABLE products ADD COLUMN created_at timestamp",
+		"ALTER TABLE products DROP COLUMN legacy",
+	}
+	if !reflect.DeepEqual(diff.Statements, want) {
+		t.Errorf("Statements = %v, want %v", diff.Statements, want)
+	}
+
+	type withSummary struct {
+		Summary string `marina:",text,indexed,stored,prefix"`
+	}
+	summary, err := SchemaOf(withSummary{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff = diffSchema("products", summary, &tableDescription{types: map[string][]string{"id": {"bigint"}}}, false)
+	wantChanged = []ColumnChange{{Name: "summary", From: []string{"text"}, To: []string{"text", "indexed", "prefix", "stored"}}}
+	if !reflect.DeepEqual(diff.Changed, wantChanged) {
+		t.Errorf("Changed of added prefix field = %v, want %v", diff.Changed, wantChanged)
+	}
+
+	diff = diffSchema("products", schema, nil, false)
+	if !diff.Create || len(diff.Statements) != 1 {
+		t.Errorf("diffSchema() of missing table = %+v", diff)
+	}
+}
@@ -0,0 +1,70 @@
+package marina
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// Tx writes of a transaction. Manticore transactions cover INSERT, REPLACE and DELETE of one RT table,
+// UPDATE is applied immediately, so it is not available here
+type Tx struct {
+	conn *sqlx.Conn
+}
+
+// NewInsert method initialize new insert request of the transaction
+func (tx *Tx) NewInsert() *Query {
+	return newQuery(tx.conn, InsertQuery)
+}
+
+// NewUpsert method initialize new upsert request of the transaction
+func (tx *Tx) NewUpsert() *Query {
+	return newQuery(tx.conn, UpsertQuery)
+}
+
+// NewDelete method initialize new delete request of the transaction
+func (tx *Tx) NewDelete() *Query {
+	return newQuery(tx.conn, DeleteQuery)
+}
+
+// NewBulkInsert method initialize new bulk insert request of the transaction
+func (tx *Tx) NewBulkInsert() *BulkQuery {
+	return newBulkQuery(tx.conn, BulkInsertQuery)
+}
+
+// NewBulkUpsert method initialize new bulk upsert request of the transaction
+func (tx *Tx) NewBulkUpsert() *BulkQuery {
+	return newBulkQuery(tx.conn, BulkUpsertQuery)
+}
+
+// Transaction runs fn between BEGIN and COMMIT on one connection, the transaction is rolled back
+// when fn returns an error or panics
+func (m *marinaClient) Transaction(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	conn, err := m.Conn.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		// the connection goes back to the pool, so it is rolled back even when ctx is done
+		if _, rollbackErr := conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK"); rollbackErr != nil && err != nil {
+			err = errors.Join(err, fmt.Errorf("rollback: %w", rollbackErr))
+		}
+	}()
+	if err = fn(&Tx{conn: conn}); err != nil {
+		return err
+	}
+	if _, err = conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,173 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iwrk-platform/framework/mongodb"
+	"github.com/uptrace/bun/migrate"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+const usage = `usage: migrate [flags] <command>
+
+commands:
+  init                create migration tables
+  up                  apply pending migrations, -dry-run prints their SQL
+  down                roll back the last migration group
+  status              list applied and pending migrations
+  create <name>       create postgres migration files in -dir
+  mark-applied        mark pending migrations as applied without running them
+
+flags:
+`
+
+// Command runs migrations outside of the application start, so they can be a separate deploy job.
+// Services mount it as a subcommand of their binary to get their Go migrations registered.
+type Command struct {
+	// Migrations Go migrations registered by the service, may be nil
+	Migrations *migrate.Migrations
+	// ModuleMigrations migrations of the framework modules used by the service, e.g. outbox.Migration()
+	ModuleMigrations []migrate.Migration
+	// MongoMigrations Go migrations of mongodb, applied with -db mongodb
+	MongoMigrations *mongodb.Migrations
+	// FS SQL migrations, when nil they are read from the -dir directory
+	FS fs.FS
+	// Dir directory for new migration files
+	Dir string
+	// ConfigPath default service config path
+	ConfigPath string
+	Out        io.Writer
+}
+
+// Run parses args (without the subcommand name) and executes the migration command
+func (c *Command) Run(ctx context.Context, args []string) error {
+	out := c.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	configPath := c.ConfigPath
+	if configPath == "" {
+		configPath = "./config.yaml"
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprint(out, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&configPath, "config", configPath, "service config path")
+	database := flags.String("db", "postgres", "database to migrate: postgres or mongodb")
+	dir := flags.String("dir", c.Dir, "migrations directory, read when FS is not set and used by create")
+	dryRun := flags.Bool("dry-run", false, "print pending migrations SQL instead of applying")
+	goMigration := flags.Bool("go", false, "create Go migration instead of SQL files")
+	txMigration := flags.Bool("tx", false, "create transactional SQL migration files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("command is not set")
+	}
+
+	// flags are accepted after the command as well: migrate up -dry-run
+	command := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return err
+	}
+	if command == "create" {
+		name := strings.Join(flags.Args(), "_")
+		return createMigration(ctx, out, *dir, name, *goMigration, *txMigration)
+	}
+
+	target, err := c.target(ctx, *database, configPath, *dir)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	switch command {
+	case "init":
+		return target.Init(ctx, out)
+	case "up":
+		if *dryRun {
+			return target.DryRun(ctx, out)
+		}
+		return target.Up(ctx, out)
+	case "down":
+		return target.Down(ctx, out)
+	case "status":
+		return target.Status(ctx, out)
+	case "mark-applied":
+		return target.MarkApplied(ctx, out)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+type target interface {
+	Init(ctx context.Context, out io.Writer) error
+	Up(ctx context.Context, out io.Writer) error
+	DryRun(ctx context.Context, out io.Writer) error
+	Down(ctx context.Context, out io.Writer) error
+	Status(ctx context.Context, out io.Writer) error
+	MarkApplied(ctx context.Context, out io.Writer) error
+	Close() error
+}
+
+func (c *Command) target(ctx context.Context, database, configPath, dir string) (target, error) {
+	switch database {
+	case "postgres":
+		fsys := c.FS
+		if fsys == nil && dir != "" {
+			// os.DirFS does not check the directory, a missing one would fail later with a walk error
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("migrations directory %q is not found, set it with -dir", dir)
+			}
+			fsys = os.DirFS(dir)
+		}
+		return newPostgresTarget(ctx, configPath, c.Migrations, fsys, c.ModuleMigrations)
+	case "mongodb":
+		return newMongodbTarget(ctx, configPath, c.MongoMigrations)
+	default:
+		return nil, fmt.Errorf("unknown database %q", database)
+	}
+}
+
+func createMigration(ctx context.Context, out io.Writer, dir, name string, goMigration, txMigration bool) error {
+	if dir == "" {
+		return errors.New("migrations directory is not set, use -dir")
+	}
+	m := migrate.NewMigrator(nil, migrate.NewMigrations(migrate.WithMigrationsDirectory(dir)))
+	var files []*migrate.MigrationFile
+	switch {
+	case goMigration:
+		file, err := m.CreateGoMigration(ctx, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	case txMigration:
+		created, err := m.CreateTxSQLMigrations(ctx, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, created...)
+	default:
+		created, err := m.CreateSQLMigrations(ctx, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, created...)
+	}
+	for _, file := range files {
+		fmt.Fprintf(out, "created %s\n", file.Path)
+	}
+	return nil
+}
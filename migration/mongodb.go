@@ -0,0 +1,132 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwrk-platform/framework/config"
+	"github.com/iwrk-platform/framework/logger"
+	"github.com/iwrk-platform/framework/mongodb"
+	"go.uber.org/fx"
+	"io"
+	"os"
+)
+
+type mongodbTarget struct {
+	db *mongodb.Mongodb
+}
+
+// newMongodbTarget builds only the config and mongodb dependencies of the service,
+// without the mongodb module lifecycle which would migrate on start
+func newMongodbTarget(ctx context.Context, configPath string, migrations *mongodb.Migrations) (*mongodbTarget, error) {
+	configFile, err := os.Open(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("open config: %w", err)
+	}
+	defer configFile.Close()
+
+	var db *mongodb.Mongodb
+	app := fx.New(
+		fx.NopLogger,
+		logger.NewModule(),
+		config.NewModule(),
+		fx.Provide(
+			func() context.Context { return ctx },
+			func() io.Reader { return configFile },
+			mongodb.NewMongoDBConfig,
+			mongodb.NewMongoDB,
+		),
+		fx.Populate(&db),
+	)
+	if err = app.Err(); err != nil {
+		return nil, err
+	}
+	if migrations == nil {
+		migrations = mongodb.NewMigrations()
+	}
+	db.UseMigrations(migrations)
+	return &mongodbTarget{db: db}, nil
+}
+
+func (t *mongodbTarget) Init(ctx context.Context, out io.Writer) error {
+	if err := t.db.InitMigrations(ctx); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "migrations collections are created")
+	return err
+}
+
+func (t *mongodbTarget) Up(ctx context.Context, out io.Writer) error {
+	applied, err := t.db.MigrateUp(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		_, err = fmt.Fprintln(out, "there are no new migrations to run (database is up to date)")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "migrated to group #%d (%s)\n", applied[0].GroupID, names(applied))
+	return err
+}
+
+func (t *mongodbTarget) DryRun(ctx context.Context, out io.Writer) error {
+	status, err := t.db.MigrationsStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range status.Pending {
+		if _, err = fmt.Fprintf(out, "-- %s\n-- go migration, commands are not available\n\n", m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *mongodbTarget) Down(ctx context.Context, out io.Writer) error {
+	rolledBack, err := t.db.MigrateDown(ctx)
+	if err != nil {
+		return err
+	}
+	if len(rolledBack) == 0 {
+		_, err = fmt.Fprintln(out, "there are no groups to roll back")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "rolled back group #%d (%s)\n", rolledBack[0].GroupID, names(rolledBack))
+	return err
+}
+
+func (t *mongodbTarget) Status(ctx context.Context, out io.Writer) error {
+	status, err := t.db.MigrationsStatus(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, status.String())
+	return err
+}
+
+func (t *mongodbTarget) MarkApplied(ctx context.Context, out io.Writer) error {
+	applied, err := t.db.MarkMigrationsApplied(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		_, err = fmt.Fprintln(out, "there are no pending migrations")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "marked as applied group #%d (%s)\n", applied[0].GroupID, names(applied))
+	return err
+}
+
+func (t *mongodbTarget) Close() error {
+	return t.db.Close(context.Background())
+}
+
+func names(migrations []mongodb.AppliedMigration) string {
+	s := ""
+	for i, m := range migrations {
+		if i > 0 {
+			s += ", "
+		}
+		s += m.String()
+	}
+	return s
+}
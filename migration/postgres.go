@@ -0,0 +1,114 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwrk-platform/framework/config"
+	"github.com/iwrk-platform/framework/logger"
+	"github.com/iwrk-platform/framework/postgres"
+	"github.com/uptrace/bun/migrate"
+	"go.uber.org/fx"
+	"io"
+	"io/fs"
+	"os"
+)
+
+type postgresTarget struct {
+	pg *postgres.Postgres
+}
+
+// newPostgresTarget builds only the config and postgres dependencies of the service,
+// without the postgres module lifecycle which would migrate on start
+func newPostgresTarget(ctx context.Context, configPath string, migrations *migrate.Migrations, fsys fs.FS, moduleMigrations []migrate.Migration) (*postgresTarget, error) {
+	configFile, err := os.Open(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("open config: %w", err)
+	}
+	defer configFile.Close()
+
+	var pg *postgres.Postgres
+	app := fx.New(
+		fx.NopLogger,
+		logger.NewModule(),
+		config.NewModule(),
+		fx.Provide(
+			func() context.Context { return ctx },
+			func() io.Reader { return configFile },
+			postgres.NewPostgresConfig,
+			postgres.NewPostgres,
+		),
+		fx.Populate(&pg),
+	)
+	if err = app.Err(); err != nil {
+		return nil, err
+	}
+	if err = pg.UseMigrations(migrations, fsys); err != nil {
+		return nil, err
+	}
+	pg.AddMigrations(moduleMigrations...)
+	return &postgresTarget{pg: pg}, nil
+}
+
+func (t *postgresTarget) Init(ctx context.Context, out io.Writer) error {
+	if err := t.pg.Migrator().Init(ctx); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "migration tables created")
+	return err
+}
+
+func (t *postgresTarget) Up(ctx context.Context, out io.Writer) error {
+	group, err := t.pg.MigrateUp(ctx)
+	if err != nil {
+		return err
+	}
+	if group.IsZero() {
+		_, err = fmt.Fprintln(out, "there are no new migrations to run (database is up to date)")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "migrated to %s\n", group)
+	return err
+}
+
+func (t *postgresTarget) DryRun(ctx context.Context, out io.Writer) error {
+	return t.pg.PendingMigrationsSQL(ctx, out)
+}
+
+func (t *postgresTarget) Down(ctx context.Context, out io.Writer) error {
+	group, err := t.pg.MigrateDown(ctx)
+	if err != nil {
+		return err
+	}
+	if group.IsZero() {
+		_, err = fmt.Fprintln(out, "there are no groups to roll back")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "rolled back %s\n", group)
+	return err
+}
+
+func (t *postgresTarget) Status(ctx context.Context, out io.Writer) error {
+	status, err := t.pg.MigrationsStatus(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, status.String())
+	return err
+}
+
+func (t *postgresTarget) MarkApplied(ctx context.Context, out io.Writer) error {
+	group, err := t.pg.MarkMigrationsApplied(ctx)
+	if err != nil {
+		return err
+	}
+	if group.IsZero() {
+		_, err = fmt.Fprintln(out, "there are no pending migrations")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "marked as applied %s\n", group)
+	return err
+}
+
+func (t *postgresTarget) Close() error {
+	return t.pg.Close()
+}
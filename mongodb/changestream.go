@@ -0,0 +1,294 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwrk-platform/framework/mqtt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChangeStreamsCollection = "change_stream_tokens"
+	maxChangeStreamBackoff         = 30 * time.Second
+	mqttPublishTimeout             = 10 * time.Second
+)
+
+// resume token is too old for the oplog or does not belong to the stream anymore
+var resumeTokenErrorCodes = []int{260, 280, 286}
+
+var ErrNoFullDocument = errors.New("mongodb: change event has no full document")
+
+type ChangeNamespace struct {
+	DB         string `bson:"db" json:"db"`
+	Collection string `bson:"coll" json:"coll"`
+}
+
+type UpdateDescription struct {
+	UpdatedFields bson.Raw `bson:"updatedFields" json:"updatedFields"`
+	RemovedFields []string `bson:"removedFields" json:"removedFields"`
+}
+
+// ChangeEvent change stream event, FullDocument is set for inserts, replaces and,
+// with the default update lookup, for updates of documents which still exist
+type ChangeEvent struct {
+	ResumeToken       bson.Raw            `bson:"_id" json:"-"`
+	OperationType     string              `bson:"operationType" json:"operationType"`
+	Namespace         ChangeNamespace     `bson:"ns" json:"ns"`
+	DocumentKey       bson.Raw            `bson:"documentKey" json:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument,omitempty" json:"fullDocument,omitempty"`
+	UpdateDescription *UpdateDescription  `bson:"updateDescription,omitempty" json:"updateDescription,omitempty"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime" json:"clusterTime"`
+}
+
+// DocumentID returns _id of the changed document
+func (e *ChangeEvent) DocumentID() interface{} {
+	if e.DocumentKey == nil {
+		return nil
+	}
+	value, err := e.DocumentKey.LookupErr("_id")
+	if err != nil {
+		return nil
+	}
+	var id interface{}
+	if err = value.Unmarshal(&id); err != nil {
+		return nil
+	}
+	return id
+}
+
+// Decode decodes the full document into v
+func (e *ChangeEvent) Decode(v interface{}) error {
+	if len(e.FullDocument) == 0 {
+		return ErrNoFullDocument
+	}
+	return bson.Unmarshal(e.FullDocument, v)
+}
+
+// ChangeHandler handles change event, on error the event is delivered again after reconnect
+type ChangeHandler func(ctx context.Context, event *ChangeEvent) error
+
+// Handle adapts typed handler, doc is nil when the event has no full document (deletes)
+func Handle[T any](handler func(ctx context.Context, event *ChangeEvent, doc *T) error) ChangeHandler {
+	return func(ctx context.Context, event *ChangeEvent) error {
+		if len(event.FullDocument) == 0 {
+			return handler(ctx, event, nil)
+		}
+		doc := new(T)
+		if err := event.Decode(doc); err != nil {
+			return fmt.Errorf("decode %s document: %w", event.Namespace.Collection, err)
+		}
+		return handler(ctx, event, doc)
+	}
+}
+
+// ForwardToMqtt publishes events as relaxed extended JSON, topic may contain {collection}
+// and {operation} placeholders
+func ForwardToMqtt(mq *mqtt.MQTT, topic string, qos byte) ChangeHandler {
+	return func(ctx context.Context, event *ChangeEvent) error {
+		payload, err := bson.MarshalExtJSON(event, false, false)
+		if err != nil {
+			return err
+		}
+		target := strings.NewReplacer("{collection}", event.Namespace.Collection, "{operation}", event.OperationType).Replace(topic)
+		token := mq.Client.Publish(target, qos, false, payload)
+		select {
+		case <-token.Done():
+			return token.Error()
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(mqttPublishTimeout):
+			return errors.New("mqtt publish timeout")
+		}
+	}
+}
+
+// ChangeStream subscription to changes of a collection
+type ChangeStream struct {
+	// Name identifies the stream resume token, keep it stable between releases, Collection by default
+	Name       string
+	Collection string
+	// Pipeline filters events, e.g. bson.D{{Key: "$match", Value: bson.M{"operationType": "insert"}}}
+	Pipeline mongo.Pipeline
+	// FullDocument updateLookup by default
+	FullDocument options.FullDocument
+	Handlers     []ChangeHandler
+}
+
+type changeStreams struct {
+	streams []ChangeStream
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// Watch adds change stream consumed after start. Events of a stream are handled one by one
+// and its resume token is saved after every handled event, so restarts continue where they left off.
+func (m *Mongodb) Watch(stream ChangeStream) {
+	if stream.Name == "" {
+		stream.Name = stream.Collection
+	}
+	m.changeStreams.streams = append(m.changeStreams.streams, stream)
+}
+
+// StartChangeStreams starts consuming registered change streams
+func (m *Mongodb) StartChangeStreams() {
+	if len(m.changeStreams.streams) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.changeStreams.cancel = cancel
+	for _, stream := range m.changeStreams.streams {
+		m.changeStreams.wg.Add(1)
+		go func(stream ChangeStream) {
+			defer m.changeStreams.wg.Done()
+			m.consume(ctx, stream)
+		}(stream)
+	}
+}
+
+// StopChangeStreams stops consumers and waits for running handlers
+func (m *Mongodb) StopChangeStreams(ctx context.Context) error {
+	if m.changeStreams.cancel == nil {
+		return nil
+	}
+	m.changeStreams.cancel()
+	stopped := make(chan struct{})
+	go func() {
+		m.changeStreams.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// consume reopens the stream from the saved resume token until ctx is cancelled
+func (m *Mongodb) consume(ctx context.Context, stream ChangeStream) {
+	logger := m.Logger.With(zap.String("stream", stream.Name), zap.String("collection", stream.Collection))
+	for attempt := 0; ; attempt++ {
+		handled, err := m.consumeOnce(ctx, stream)
+		if ctx.Err() != nil {
+			return
+		}
+		if handled {
+			attempt = 0
+		}
+		if isResumeTokenError(err) {
+			logger.Warn("resume token is lost, events since the last handled one are skipped", zap.Error(err))
+			if err = m.deleteResumeToken(ctx, stream.Name); err == nil {
+				continue
+			}
+		}
+		delay := min(time.Second<<min(attempt, 5), maxChangeStreamBackoff)
+		logger.Warn("change stream interrupted", zap.Error(err), zap.Duration("retry", delay))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (m *Mongodb) consumeOnce(ctx context.Context, stream ChangeStream) (handled bool, err error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if stream.FullDocument != "" {
+		opts.SetFullDocument(stream.FullDocument)
+	}
+	token, err := m.loadResumeToken(ctx, stream.Name)
+	if err != nil {
+		return false, err
+	}
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+	pipeline := stream.Pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	cs, err := m.DB.Collection(stream.Collection).Watch(ctx, pipeline, opts)
+	if err != nil {
+		return false, fmt.Errorf("watch: %w", err)
+	}
+	defer cs.Close(context.WithoutCancel(ctx))
+
+	for cs.Next(ctx) {
+		event := &ChangeEvent{}
+		if err = cs.Decode(event); err != nil {
+			return handled, fmt.Errorf("decode event: %w", err)
+		}
+		for _, handler := range stream.Handlers {
+			if err = handler(ctx, event); err != nil {
+				return handled, fmt.Errorf("handle %s of %v: %w", event.OperationType, event.DocumentID(), err)
+			}
+		}
+		if err = m.saveResumeToken(ctx, stream.Name, cs.ResumeToken()); err != nil {
+			return handled, err
+		}
+		handled = true
+	}
+	if err = cs.Err(); err == nil {
+		err = errors.New("change stream closed")
+	}
+	return handled, err
+}
+
+func (m *Mongodb) resumeTokens() *mongo.Collection {
+	name := m.Config.ChangeStreamsCollection
+	if name == "" {
+		name = defaultChangeStreamsCollection
+	}
+	return m.DB.Collection(name)
+}
+
+func (m *Mongodb) loadResumeToken(ctx context.Context, name string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := m.resumeTokens().FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load resume token: %w", err)
+	}
+	return doc.Token, nil
+}
+
+func (m *Mongodb) saveResumeToken(ctx context.Context, name string, token bson.Raw) error {
+	_, err := m.resumeTokens().UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("save resume token: %w", err)
+	}
+	return nil
+}
+
+func (m *Mongodb) deleteResumeToken(ctx context.Context, name string) error {
+	_, err := m.resumeTokens().DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
+
+func isResumeTokenError(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	for _, code := range resumeTokenErrorCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestChangeEventDocumentID(t *testing.T) {
+	key, err := bson.Marshal(bson.M{"_id": int64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noID, err := bson.Marshal(bson.M{"other": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		event ChangeEvent
+		want  interface{}
+	}{
+		{name: "id", event: ChangeEvent{DocumentKey: key}, want: int64(7)},
+		{name: "no key", event: ChangeEvent{}},
+		{name: "no id", event: ChangeEvent{DocumentKey: noID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.DocumentID(); got != tt.want {
+				t.Errorf("DocumentID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeEventDecode(t *testing.T) {
+	doc, err := bson.Marshal(bson.M{"name": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Name string `bson:"name"`
+	}
+	if err = (&ChangeEvent{FullDocument: doc}).Decode(&v); err != nil || v.Name != "a" {
+		t.Errorf("Decode() = %+v, %v", v, err)
+	}
+	if err = (&ChangeEvent{}).Decode(&v); !errors.Is(err, ErrNoFullDocument) {
+		t.Errorf("Decode() of delete error = %v, want %v", err, ErrNoFullDocument)
+	}
+}
+
+func TestIsResumeTokenError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "history lost", err: mongo.CommandError{Code: 286}, want: true},
+		{name: "wrapped", err: fmt.Errorf("watch: %w", mongo.CommandError{Code: 280}), want: true},
+		{name: "other code", err: mongo.CommandError{Code: 11000}},
+		{name: "not a server error", err: errors.New("network")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isResumeTokenError(tt.err); got != tt.want {
+				t.Errorf("isResumeTokenError() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,76 @@
 package mongodb
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/config"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 )
 
+const defaultConnectTimeout = 10 * time.Second
+
+var uriCredentialsRE = regexp.MustCompile(`^([a-z+]+://)[^@/]*@`)
+
 type Config struct {
+	// URI full connection string, fields below override its options when set
+	URI      string `yaml:"uri"`
 	Host     string `yaml:"host"`
 	Port     string `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Database string `yaml:"database"`
+	// AuthSource database of the user, Database by default
+	AuthSource string `yaml:"auth_source"`
+	// AuthMechanism SCRAM-SHA-1, SCRAM-SHA-256, MONGODB-X509..., negotiated with the server by default
+	AuthMechanism string `yaml:"auth_mechanism"`
+	ReplicaSet    string `yaml:"replica_set"`
+	// ReadPreference primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	ReadPreference string `yaml:"read_preference"`
+
+	TLS bool `yaml:"tls"`
+	// TLSCAFile CA certificate used to verify the server
+	TLSCAFile string `yaml:"tls_ca_file"`
+	// TLSCertificateKeyFile PEM file with client certificate and key
+	TLSCertificateKeyFile string `yaml:"tls_certificate_key_file"`
+	TLSInsecure           bool   `yaml:"tls_insecure"`
+
+	MinPoolSize     uint64        `yaml:"min_pool_size"`
+	MaxPoolSize     uint64        `yaml:"max_pool_size"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+
+	// ConnectTimeout 10s by default
+	ConnectTimeout         time.Duration `yaml:"connect_timeout"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout"`
+	SocketTimeout          time.Duration `yaml:"socket_timeout"`
+	// OperationTimeout timeout of mgm operations without context, 10s by default
+	OperationTimeout time.Duration `yaml:"operation_timeout"`
+
+	// MigrationsCollection applied migrations collection, migrations by default
+	MigrationsCollection string `yaml:"migrations_collection"`
+	// MigrationsLockTTL after which the lock of a crashed migration process expires, 10m by default
+	MigrationsLockTTL time.Duration `yaml:"migrations_lock_ttl"`
+	// MigrationsLockWait how long to wait for migrations run by another instance, 1m by default
+	MigrationsLockWait time.Duration `yaml:"migrations_lock_wait"`
+
+	// CounterCollection collection of BaseModel id sequences, counter by default
+	CounterCollection string `yaml:"counter_collection"`
+	// IDBlockSize BaseModel ids reserved per round trip to the counter collection, 1 by default
+	IDBlockSize int64 `yaml:"id_block_size"`
+
+	// ChangeStreamsCollection collection of change stream resume tokens, change_stream_tokens by default
+	ChangeStreamsCollection string `yaml:"change_streams_collection"`
+
+	// IndexesDryRun only logs index changes of registered models on start
+	IndexesDryRun bool `yaml:"indexes_dry_run"`
+	// IndexesDropUnknown drops indexes not declared by registered models of their collections
+	IndexesDropUnknown bool `yaml:"indexes_drop_unknown"`
 }
 
 func NewMongoDBConfig(provider config.Provider) (*Config, error) {
@@ -20,3 +80,116 @@ func NewMongoDBConfig(provider config.Provider) (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// ClientOptions builds driver options of config
+func (c *Config) ClientOptions() (*options.ClientOptions, error) {
+	opts := options.Client()
+	if c.URI != "" {
+		opts.ApplyURI(c.URI)
+	} else {
+		opts.SetHosts(c.hosts())
+		opts.SetConnectTimeout(defaultConnectTimeout)
+	}
+	if c.User != "" {
+		authSource := c.AuthSource
+		if authSource == "" {
+			authSource = c.Database
+		}
+		opts.SetAuth(options.Credential{
+			AuthMechanism: c.AuthMechanism,
+			AuthSource:    authSource,
+			Username:      c.User,
+			Password:      c.Password,
+		})
+	}
+	if c.ReplicaSet != "" {
+		opts.SetReplicaSet(c.ReplicaSet)
+	}
+	if c.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(c.ReadPreference)
+		if err != nil {
+			return nil, fmt.Errorf("read preference: %w", err)
+		}
+		pref, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("read preference: %w", err)
+		}
+		opts.SetReadPreference(pref)
+	}
+	if c.TLS {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(c.MaxConnIdleTime)
+	}
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+	if c.SocketTimeout > 0 {
+		opts.SetSocketTimeout(c.SocketTimeout)
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("mongodb options: %w", err)
+	}
+	return opts, nil
+}
+
+// Redacted describes the connection for logs without credentials
+func (c *Config) Redacted() string {
+	if c.URI != "" {
+		return uriCredentialsRE.ReplaceAllString(c.URI, "${1}xxxxx@")
+	}
+	user := ""
+	if c.User != "" {
+		user = c.User + ":xxxxx@"
+	}
+	return "mongodb://" + user + strings.Join(c.hosts(), ",") + "/" + c.Database
+}
+
+// hosts of comma separated Host, Port is added to hosts without one
+func (c *Config) hosts() []string {
+	hosts := strings.Split(c.Host, ",")
+	for i, host := range hosts {
+		host = strings.TrimSpace(host)
+		if _, _, err := net.SplitHostPort(host); err != nil && c.Port != "" {
+			host = net.JoinHostPort(host, c.Port)
+		}
+		hosts[i] = host
+	}
+	return hosts
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.TLSInsecure}
+	if c.TLSCAFile != "" {
+		ca, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("tls ca file %s has no certificates", c.TLSCAFile)
+		}
+	}
+	if c.TLSCertificateKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertificateKeyFile, c.TLSCertificateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls certificate key file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -2,8 +2,8 @@ package mongodb
 
 import (
 	"context"
-	"github.com/kamva/mgm/v3"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"errors"
+	"fmt"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -15,10 +15,24 @@ func NewModule() fx.Option {
 			NewMongoDBConfig,
 			NewMongoDB,
 		),
-		fx.Invoke(func(lc fx.Lifecycle, config *Config) {
+		fx.Invoke(func(lc fx.Lifecycle, db *Mongodb) {
 			lc.Append(fx.Hook{
-				OnStart: func(_ context.Context) error {
-					return mgm.SetDefaultConfig(nil, config.Database, options.Client().ApplyURI("mongodb://"+config.User+":"+config.Password+"@"+config.Host+"/"+config.Database+"?retryWrites=true&replicaSet=dbrs&readPreference=primary&connectTimeoutMS=10000&authSource="+config.Database+"&authMechanism=SCRAM-SHA-1"))
+				OnStart: func(ctx context.Context) error {
+					if err := db.Ping(ctx); err != nil {
+						return fmt.Errorf("mongodb ping %s: %w", db.Config.Redacted(), err)
+					}
+					db.Logger.Info("connected", zap.String("uri", db.Config.Redacted()))
+					if err := db.StartMigrations(ctx); err != nil {
+						return err
+					}
+					if err := db.StartIndexes(ctx); err != nil {
+						return err
+					}
+					db.StartChangeStreams()
+					return nil
+				},
+				OnStop: func(ctx context.Context) error {
+					return errors.Join(db.StopChangeStreams(ctx), db.Close(ctx))
 				},
 			})
 		}),
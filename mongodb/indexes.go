@@ -0,0 +1,356 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultIndexName = "_id_"
+
+// Index declaration of a model index
+type Index struct {
+	// Name index name, generated from keys like mongo does when empty
+	Name string
+	// Keys fields in index order: "field" ascending, "-field" descending, "$text:field" text,
+	// "$<type>:field" other index types like "$2dsphere:location"
+	Keys   []string
+	Unique bool
+	Sparse bool
+	// TTL documents expire after TTL from the time stored in the single date key
+	TTL time.Duration
+	// Partial filter of indexed documents
+	Partial bson.D
+	// Weights of text index fields
+	Weights bson.D
+}
+
+// Indexed models declare their indexes, they are reconciled on start of the mongodb module
+type Indexed interface {
+	mgm.Model
+	Indexes() []Index
+}
+
+// IndexSyncOptions of SyncIndexes
+type IndexSyncOptions struct {
+	// DryRun only reports changes
+	DryRun bool
+	// DropUnknown drops indexes which are not declared by models of their collection
+	DropUnknown bool
+}
+
+// IndexDrift existing index which definition differs from the declared one, it is not changed
+// automatically, drop it or rename the declared index in a migration
+type IndexDrift struct {
+	Collection string
+	Name       string
+	Reason     string
+}
+
+type IndexReport struct {
+	Created []string
+	Dropped []string
+	Unknown []string
+	Drift   []IndexDrift
+}
+
+func (r *IndexReport) IsEmpty() bool {
+	return len(r.Created) == 0 && len(r.Dropped) == 0 && len(r.Unknown) == 0 && len(r.Drift) == 0
+}
+
+// RegisterIndexes adds models which indexes are reconciled on start
+func (m *Mongodb) RegisterIndexes(models ...Indexed) {
+	m.indexed = append(m.indexed, models...)
+}
+
+// StartIndexes reconciles indexes of registered models with IndexSyncOptions of config
+func (m *Mongodb) StartIndexes(ctx context.Context) error {
+	if len(m.indexed) == 0 {
+		return nil
+	}
+	report, err := m.SyncIndexes(ctx, IndexSyncOptions{
+		DryRun:      m.Config.IndexesDryRun,
+		DropUnknown: m.Config.IndexesDropUnknown,
+	})
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if m.Config.IndexesDryRun {
+		prefix = "dry run: "
+	}
+	for _, name := range report.Created {
+		m.Logger.Info(prefix+"index created", zap.String("index", name))
+	}
+	for _, name := range report.Dropped {
+		m.Logger.Info(prefix+"index dropped", zap.String("index", name))
+	}
+	for _, name := range report.Unknown {
+		m.Logger.Warn("index is not declared by models", zap.String("index", name))
+	}
+	for _, drift := range report.Drift {
+		m.Logger.Warn("index differs from declaration",
+			zap.String("index", drift.Collection+"."+drift.Name), zap.String("reason", drift.Reason))
+	}
+	return nil
+}
+
+// SyncIndexes creates missing declared indexes of registered models, reports changed ones
+// and drops or reports indexes which are not declared
+func (m *Mongodb) SyncIndexes(ctx context.Context, opts IndexSyncOptions) (*IndexReport, error) {
+	declared := make(map[string][]Index)
+	collections := make([]string, 0)
+	for _, model := range m.indexed {
+		collection := mgm.CollName(model)
+		if _, ok := declared[collection]; !ok {
+			collections = append(collections, collection)
+		}
+		declared[collection] = append(declared[collection], model.Indexes()...)
+	}
+
+	report := &IndexReport{}
+	for _, collection := range collections {
+		if err := m.syncCollectionIndexes(ctx, collection, declared[collection], opts, report); err != nil {
+			return report, fmt.Errorf("sync indexes of %s: %w", collection, err)
+		}
+	}
+	return report, nil
+}
+
+func (m *Mongodb) syncCollectionIndexes(ctx context.Context, collection string, indexes []Index, opts IndexSyncOptions, report *IndexReport) error {
+	view := m.DB.Collection(collection).Indexes()
+	cursor, err := view.List(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make([]bson.D, 0)
+	if err = cursor.All(ctx, &existing); err != nil {
+		return err
+	}
+	byName := make(map[string]bson.M, len(existing))
+	for _, spec := range existing {
+		doc := make(bson.M, len(spec))
+		for _, e := range spec {
+			doc[e.Key] = e.Value
+		}
+		byName[fmt.Sprint(doc["name"])] = doc
+	}
+
+	wanted := make(map[string]bool, len(indexes))
+	create := make([]mongo.IndexModel, 0)
+	for _, index := range indexes {
+		model, err := index.Model()
+		if err != nil {
+			return err
+		}
+		name := *model.Options.Name
+		wanted[name] = true
+		current, ok := byName[name]
+		if !ok {
+			create = append(create, model)
+			report.Created = append(report.Created, collection+"."+name)
+			continue
+		}
+		if reason := index.diff(current); reason != "" {
+			report.Drift = append(report.Drift, IndexDrift{Collection: collection, Name: name, Reason: reason})
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range byName {
+		if name != defaultIndexName && !wanted[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		if opts.DropUnknown {
+			report.Dropped = append(report.Dropped, collection+"."+name)
+		} else {
+			report.Unknown = append(report.Unknown, collection+"."+name)
+		}
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	if len(create) > 0 {
+		if _, err = view.CreateMany(ctx, create); err != nil {
+			return err
+		}
+	}
+	if opts.DropUnknown {
+		for _, name := range unknown {
+			if _, err = view.DropOne(ctx, name); err != nil {
+				return fmt.Errorf("drop %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Model builds driver index model of the declaration
+func (i Index) Model() (mongo.IndexModel, error) {
+	keys, err := i.keys()
+	if err != nil {
+		return mongo.IndexModel{}, err
+	}
+	name := i.Name
+	if name == "" {
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			parts = append(parts, fmt.Sprintf("%s_%v", key.Key, key.Value))
+		}
+		name = strings.Join(parts, "_")
+	}
+	opts := options.Index().SetName(name)
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.Sparse {
+		opts.SetSparse(true)
+	}
+	if i.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(i.TTL.Seconds()))
+	}
+	if len(i.Partial) > 0 {
+		opts.SetPartialFilterExpression(i.Partial)
+	}
+	if len(i.Weights) > 0 {
+		opts.SetWeights(i.Weights)
+	}
+	return mongo.IndexModel{Keys: keys, Options: opts}, nil
+}
+
+func (i Index) keys() (bson.D, error) {
+	if len(i.Keys) == 0 {
+		return nil, fmt.Errorf("index %s has no keys", i.Name)
+	}
+	keys := make(bson.D, 0, len(i.Keys))
+	for _, key := range i.Keys {
+		switch {
+		case strings.HasPrefix(key, "$"):
+			kind, field, ok := strings.Cut(strings.TrimPrefix(key, "$"), ":")
+			if !ok || kind == "" || field == "" {
+				return nil, fmt.Errorf("invalid index key %s", key)
+			}
+			keys = append(keys, bson.E{Key: field, Value: kind})
+		case strings.HasPrefix(key, "-"):
+			keys = append(keys, bson.E{Key: strings.TrimPrefix(key, "-"), Value: int32(-1)})
+		default:
+			keys = append(keys, bson.E{Key: key, Value: int32(1)})
+		}
+	}
+	return keys, nil
+}
+
+// diff describes differences of the declaration and the listed index spec
+func (i Index) diff(spec bson.M) string {
+	reasons := make([]string, 0)
+	keys, _ := i.keys()
+	if !i.isText() {
+		if !sameKeys(keys, spec["key"]) {
+			reasons = append(reasons, fmt.Sprintf("keys %v, declared %v", spec["key"], keys))
+		}
+	} else if !sameTextFields(keys, spec["weights"]) {
+		reasons = append(reasons, fmt.Sprintf("text fields %v, declared %v", spec["weights"], i.Keys))
+	}
+	if unique, _ := spec["unique"].(bool); unique != i.Unique {
+		reasons = append(reasons, fmt.Sprintf("unique %t, declared %t", unique, i.Unique))
+	}
+	if sparse, _ := spec["sparse"].(bool); sparse != i.Sparse {
+		reasons = append(reasons, fmt.Sprintf("sparse %t, declared %t", sparse, i.Sparse))
+	}
+	if ttl := toInt64(spec["expireAfterSeconds"]); ttl != int64(i.TTL.Seconds()) {
+		reasons = append(reasons, fmt.Sprintf("ttl %ds, declared %ds", ttl, int64(i.TTL.Seconds())))
+	}
+	if !sameDocument(spec["partialFilterExpression"], i.Partial) {
+		reasons = append(reasons, fmt.Sprintf("partial filter %v, declared %v", spec["partialFilterExpression"], i.Partial))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (i Index) isText() bool {
+	for _, key := range i.Keys {
+		if strings.HasPrefix(key, "$text:") {
+			return true
+		}
+	}
+	return false
+}
+
+func sameKeys(declared bson.D, current any) bool {
+	keys, ok := current.(bson.D)
+	if !ok || len(keys) != len(declared) {
+		return false
+	}
+	for i, key := range keys {
+		if key.Key != declared[i].Key {
+			return false
+		}
+		if s, ok := declared[i].Value.(string); ok {
+			if key.Value != s {
+				return false
+			}
+			continue
+		}
+		if toInt64(key.Value) != toInt64(declared[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameTextFields compares text fields, text index specs list them in weights instead of keys
+func sameTextFields(declared bson.D, weights any) bool {
+	current, ok := weights.(bson.D)
+	if !ok {
+		return false
+	}
+	fields := make(map[string]bool)
+	for _, key := range declared {
+		if key.Value == "text" {
+			fields[key.Key] = true
+		}
+	}
+	if len(fields) != len(current) {
+		return false
+	}
+	for _, weight := range current {
+		if !fields[weight.Key] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameDocument(current any, declared bson.D) bool {
+	if current == nil {
+		return len(declared) == 0
+	}
+	a, errA := bson.Marshal(current)
+	b, errB := bson.Marshal(declared)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+func toInt64(v any) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	case int:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package mongodb
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		index    Index
+		wantName string
+		wantKeys bson.D
+		wantErr  bool
+	}{
+		{
+			name:     "generated name",
+			index:    Index{Keys: []string{"user_id", "-created_at"}},
+			wantName: "user_id_1_created_at_-1",
+			wantKeys: bson.D{{Key: "user_id", Value: int32(1)}, {Key: "created_at", Value: int32(-1)}},
+		},
+		{
+			name:     "typed keys",
+			index:    Index{Name: "search", Keys: []string{"$text:title", "$2dsphere:location"}},
+			wantName: "search",
+			wantKeys: bson.D{{Key: "title", Value: "text"}, {Key: "location", Value: "2dsphere"}},
+		},
+		{name: "no keys", index: Index{Name: "empty"}, wantErr: true},
+		{name: "invalid typed key", index: Index{Keys: []string{"$text"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := tt.index.Model()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Model() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if *model.Options.Name != tt.wantName {
+				t.Errorf("Name = %s, want %s", *model.Options.Name, tt.wantName)
+			}
+			if !reflect.DeepEqual(model.Keys, tt.wantKeys) {
+				t.Errorf("Keys = %v, want %v", model.Keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestIndexDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		index Index
+		spec  bson.M
+		// want substrings of the reason, the index is the same when empty
+		want []string
+	}{
+		{
+			name:  "same",
+			index: Index{Keys: []string{"email"}, Unique: true, TTL: time.Hour},
+			spec:  bson.M{"key": bson.D{{Key: "email", Value: int32(1)}}, "unique": true, "expireAfterSeconds": int32(3600)},
+		},
+		{
+			name:  "float key of listed spec",
+			index: Index{Keys: []string{"-score"}},
+			spec:  bson.M{"key": bson.D{{Key: "score", Value: float64(-1)}}},
+		},
+		{
+			name:  "keys",
+			index: Index{Keys: []string{"email", "tenant"}},
+			spec:  bson.M{"key": bson.D{{Key: "email", Value: int32(1)}}},
+			want:  []string{"keys"},
+		},
+		{
+			name:  "direction",
+			index: Index{Keys: []string{"-email"}},
+			spec:  bson.M{"key": bson.D{{Key: "email", Value: int32(1)}}},
+			want:  []string{"keys"},
+		},
+		{
+			name:  "options",
+			index: Index{Keys: []string{"email"}, Sparse: true},
+			spec:  bson.M{"key": bson.D{{Key: "email", Value: int32(1)}}, "unique": true, "expireAfterSeconds": int32(60)},
+			want:  []string{"unique true, declared false", "sparse false, declared true", "ttl 60s, declared 0s"},
+		},
+		{
+			name:  "partial filter",
+			index: Index{Keys: []string{"email"}, Partial: bson.D{{Key: "deleted_at", Value: int32(0)}}},
+			spec:  bson.M{"key": bson.D{{Key: "email", Value: int32(1)}}, "partialFilterExpression": bson.D{{Key: "deleted_at", Value: int32(0)}}},
+		},
+		{
+			name:  "missing partial filter",
+			index: Index{Keys: []string{"email"}, Partial: bson.D{{Key: "deleted_at", Value: int32(0)}}},
+			spec:  bson.M{"key": bson.D{{Key: "email", Value: int32(1)}}},
+			want:  []string{"partial filter"},
+		},
+		{
+			name:  "text fields",
+			index: Index{Keys: []string{"$text:title", "$text:body"}},
+			spec:  bson.M{"key": bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}, "weights": bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}}},
+		},
+		{
+			name:  "changed text fields",
+			index: Index{Keys: []string{"$text:title"}},
+			spec:  bson.M{"key": bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}, "weights": bson.D{{Key: "body", Value: int32(1)}}},
+			want:  []string{"text fields"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.index.diff(tt.spec)
+			if len(tt.want) == 0 && got != "" {
+				t.Errorf("diff() = %q, want no differences", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("diff() = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
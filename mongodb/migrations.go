@@ -0,0 +1,403 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMigrationsCollection = "migrations"
+	migrationLocksCollection    = "migration_locks"
+	migrationsLockID            = "migrations"
+	defaultMigrationsLockTTL    = 10 * time.Minute
+	defaultMigrationsLockWait   = time.Minute
+	indexNotFoundCode           = 27
+)
+
+var (
+	ErrMigrationsLocked   = errors.New("mongodb: migrations are locked by another process")
+	ErrMigrationsLockLost = errors.New("mongodb: migrations lock expired and was taken by another process")
+)
+
+// Migration Go migration, migrations are applied in Name order, use the creation time like 20240801120000
+type Migration struct {
+	Name    string
+	Comment string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+func (m Migration) String() string {
+	if m.Comment == "" {
+		return m.Name
+	}
+	return m.Name + "_" + m.Comment
+}
+
+type Migrations struct {
+	migrations []Migration
+}
+
+func NewMigrations(migrations ...Migration) *Migrations {
+	m := &Migrations{}
+	m.Add(migrations...)
+	return m
+}
+
+func (m *Migrations) Add(migrations ...Migration) {
+	m.migrations = append(m.migrations, migrations...)
+}
+
+// Sorted returns migrations ordered by name
+func (m *Migrations) Sorted() []Migration {
+	sorted := append([]Migration{}, m.migrations...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// AppliedMigration document of the migrations collection
+type AppliedMigration struct {
+	Name       string    `bson:"_id"`
+	Comment    string    `bson:"comment"`
+	GroupID    int64     `bson:"group_id"`
+	MigratedAt time.Time `bson:"migrated_at"`
+}
+
+func (m AppliedMigration) String() string {
+	if m.Comment == "" {
+		return m.Name
+	}
+	return m.Name + "_" + m.Comment
+}
+
+type MigrationsStatus struct {
+	Applied []AppliedMigration
+	Pending []Migration
+}
+
+func (s *MigrationsStatus) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("applied: %d, pending: %d\n", len(s.Applied), len(s.Pending)))
+	for _, m := range s.Applied {
+		sb.WriteString(fmt.Sprintf("  [x] %s (group %d, %s)\n", m, m.GroupID, m.MigratedAt.Format("2006-01-02 15:04:05")))
+	}
+	for _, m := range s.Pending {
+		sb.WriteString(fmt.Sprintf("  [ ] %s\n", m))
+	}
+	return sb.String()
+}
+
+// UseMigrations sets migrations applied on start
+func (m *Mongodb) UseMigrations(migrations *Migrations) {
+	m.Migrations = migrations
+}
+
+// StartMigrations applies pending migrations, any lock or migration error fails the start
+func (m *Mongodb) StartMigrations(ctx context.Context) error {
+	if m.Migrations == nil {
+		return nil
+	}
+	applied, err := m.MigrateUp(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		m.Logger.Info("there are no new migrations to run (database is up to date)")
+		return nil
+	}
+	m.Logger.Info("migrated", zap.Int64("group", applied[0].GroupID), zap.Int("migrations", len(applied)))
+	return nil
+}
+
+// MigrateUp applies pending migrations as a new group and returns them
+func (m *Mongodb) MigrateUp(ctx context.Context) ([]AppliedMigration, error) {
+	return m.migrateUp(ctx, true)
+}
+
+// MarkMigrationsApplied records pending migrations as applied without running them
+func (m *Mongodb) MarkMigrationsApplied(ctx context.Context) ([]AppliedMigration, error) {
+	return m.migrateUp(ctx, false)
+}
+
+func (m *Mongodb) migrateUp(ctx context.Context, run bool) ([]AppliedMigration, error) {
+	applied := make([]AppliedMigration, 0)
+	err := m.withMigrationsLock(ctx, func(ctx context.Context) error {
+		status, err := m.MigrationsStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if len(status.Pending) == 0 {
+			return nil
+		}
+		groupID := int64(1)
+		if len(status.Applied) > 0 {
+			groupID = status.Applied[len(status.Applied)-1].GroupID + 1
+		}
+		for _, migration := range status.Pending {
+			if run && migration.Up != nil {
+				if err = migration.Up(ctx, m.DB); err != nil {
+					return fmt.Errorf("migration %s: %w", migration, err)
+				}
+			}
+			record := AppliedMigration{
+				Name:       migration.Name,
+				Comment:    migration.Comment,
+				GroupID:    groupID,
+				MigratedAt: time.Now(),
+			}
+			if _, err = m.migrationsCollection().InsertOne(ctx, record); err != nil {
+				return fmt.Errorf("record migration %s: %w", migration, err)
+			}
+			applied = append(applied, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return applied, fmt.Errorf("migrate: %w", err)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the last applied group in reverse order and returns rolled back migrations
+func (m *Mongodb) MigrateDown(ctx context.Context) ([]AppliedMigration, error) {
+	rolledBack := make([]AppliedMigration, 0)
+	err := m.withMigrationsLock(ctx, func(ctx context.Context) error {
+		status, err := m.MigrationsStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if len(status.Applied) == 0 {
+			return nil
+		}
+		known := make(map[string]Migration)
+		if m.Migrations != nil {
+			for _, migration := range m.Migrations.migrations {
+				known[migration.Name] = migration
+			}
+		}
+		groupID := status.Applied[len(status.Applied)-1].GroupID
+		for i := len(status.Applied) - 1; i >= 0 && status.Applied[i].GroupID == groupID; i-- {
+			record := status.Applied[i]
+			migration, ok := known[record.Name]
+			if !ok {
+				return fmt.Errorf("migration %s is not registered", record)
+			}
+			if migration.Down != nil {
+				if err = migration.Down(ctx, m.DB); err != nil {
+					return fmt.Errorf("rollback %s: %w", record, err)
+				}
+			}
+			if _, err = m.migrationsCollection().DeleteOne(ctx, bson.M{"_id": record.Name}); err != nil {
+				return fmt.Errorf("unrecord migration %s: %w", record, err)
+			}
+			rolledBack = append(rolledBack, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return rolledBack, fmt.Errorf("rollback: %w", err)
+	}
+	return rolledBack, nil
+}
+
+// InitMigrations creates the migrations and locks collections and the group index of migrations,
+// existing collections and indexes are kept
+func (m *Mongodb) InitMigrations(ctx context.Context) error {
+	migrations := m.migrationsCollection().Name()
+	names, err := m.DB.ListCollectionNames(ctx, bson.M{"name": bson.M{"$in": []string{migrations, migrationLocksCollection}}})
+	if err != nil {
+		return fmt.Errorf("init migrations: %w", err)
+	}
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+	for _, name := range []string{migrations, migrationLocksCollection} {
+		if exists[name] {
+			continue
+		}
+		if err = m.DB.CreateCollection(ctx, name); err != nil {
+			return fmt.Errorf("init migrations: create %s: %w", name, err)
+		}
+	}
+	return CreateIndexes(ctx, m.DB, migrations, mongo.IndexModel{Keys: IndexKeys("group_id", "_id")})
+}
+
+// MigrationsStatus returns applied and pending migrations
+func (m *Mongodb) MigrationsStatus(ctx context.Context) (*MigrationsStatus, error) {
+	cursor, err := m.migrationsCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+	applied := make([]AppliedMigration, 0)
+	if err = cursor.All(ctx, &applied); err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+	sort.SliceStable(applied, func(i, j int) bool {
+		if applied[i].GroupID != applied[j].GroupID {
+			return applied[i].GroupID < applied[j].GroupID
+		}
+		return applied[i].Name < applied[j].Name
+	})
+	isApplied := make(map[string]bool, len(applied))
+	for _, record := range applied {
+		isApplied[record.Name] = true
+	}
+	pending := make([]Migration, 0)
+	if m.Migrations != nil {
+		for _, migration := range m.Migrations.Sorted() {
+			if !isApplied[migration.Name] {
+				pending = append(pending, migration)
+			}
+		}
+	}
+	return &MigrationsStatus{Applied: applied, Pending: pending}, nil
+}
+
+// withMigrationsLock runs fn holding the migrations lock document. The lock expires after
+// MigrationsLockTTL, so a crashed process does not block migrations forever, and is renewed while fn runs.
+// When renewal finds the lock taken by another process, ctx of fn is canceled with ErrMigrationsLockLost.
+func (m *Mongodb) withMigrationsLock(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ttl := m.Config.MigrationsLockTTL
+	if ttl <= 0 {
+		ttl = defaultMigrationsLockTTL
+	}
+	wait := m.Config.MigrationsLockWait
+	if wait <= 0 {
+		wait = defaultMigrationsLockWait
+	}
+	owner := lockOwner()
+	locks := m.DB.Collection(migrationLocksCollection)
+	deadline := time.Now().Add(wait)
+	for {
+		// an existing unexpired lock does not match the filter, so the upsert fails with a duplicate key
+		_, err = locks.UpdateOne(ctx,
+			bson.M{"_id": migrationsLockID, "expires_at": bson.M{"$lt": time.Now()}},
+			bson.M{"$set": bson.M{"owner": owner, "expires_at": time.Now().Add(ttl)}},
+			options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("lock migrations: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return ErrMigrationsLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		m.renewMigrationsLock(lockCtx, cancel, owner, ttl)
+	}()
+	defer func() {
+		cancel(nil)
+		<-renewed
+		_, errUnlock := locks.DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": migrationsLockID, "owner": owner})
+		if errUnlock != nil {
+			err = errors.Join(err, fmt.Errorf("unlock migrations: %w", errUnlock))
+		}
+	}()
+	if err = fn(lockCtx); err != nil {
+		if cause := context.Cause(lockCtx); errors.Is(cause, ErrMigrationsLockLost) {
+			err = errors.Join(cause, err)
+		}
+	}
+	return err
+}
+
+// renewMigrationsLock extends the lock of owner every third of ttl until ctx is done
+func (m *Mongodb) renewMigrationsLock(ctx context.Context, cancel context.CancelCauseFunc, owner string, ttl time.Duration) {
+	locks := m.DB.Collection(migrationLocksCollection)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		res, err := locks.UpdateOne(ctx,
+			bson.M{"_id": migrationsLockID, "owner": owner},
+			bson.M{"$set": bson.M{"expires_at": time.Now().Add(ttl)}})
+		if err != nil {
+			if ctx.Err() == nil {
+				// the lock is still valid until expires_at, the next tick retries
+				m.Logger.Warn("migrations lock renewal failed", zap.Error(err))
+			}
+			continue
+		}
+		if res.MatchedCount == 0 {
+			cancel(ErrMigrationsLockLost)
+			return
+		}
+	}
+}
+
+func (m *Mongodb) migrationsCollection() *mongo.Collection {
+	name := m.Config.MigrationsCollection
+	if name == "" {
+		name = defaultMigrationsCollection
+	}
+	return m.DB.Collection(name)
+}
+
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// IndexKeys builds index keys of fields, "-" prefix for descending order
+func IndexKeys(fields ...string) bson.D {
+	keys := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			keys = append(keys, bson.E{Key: strings.TrimPrefix(field, "-"), Value: -1})
+			continue
+		}
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	return keys
+}
+
+// CreateIndexes creates indexes of collection, existing indexes with the same definition are kept
+func CreateIndexes(ctx context.Context, db *mongo.Database, collection string, indexes ...mongo.IndexModel) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("create indexes of %s: %w", collection, err)
+	}
+	return nil
+}
+
+// DropIndex drops index name of collection, missing index is not an error so Down migrations can be rerun
+func DropIndex(ctx context.Context, db *mongo.Database, collection, name string) error {
+	_, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == indexNotFoundCode {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("drop index %s of %s: %w", name, collection, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const fieldDeletedAt = "deleted_at"
+
+// ObjectIDModel alternative of BaseModel with ObjectID ids generated on the client, no counter round trips
+type ObjectIDModel struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt int64              `json:"created_at" bson:"created_at"`
+	UpdatedAt int64              `json:"updated_at" bson:"updated_at"`
+	DeletedAt int64              `json:"deleted_at" bson:"deleted_at"`
+}
+
+func (b *ObjectIDModel) Creating(_ context.Context) error {
+	b.CreatedAt = time.Now().Unix()
+	b.UpdatedAt = b.CreatedAt
+	if b.ID.IsZero() {
+		b.ID = primitive.NewObjectID()
+	}
+	return nil
+}
+
+func (b *ObjectIDModel) Updating(_ context.Context) error {
+	b.UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+func (b *ObjectIDModel) SetID(id interface{}) {
+	switch v := id.(type) {
+	case primitive.ObjectID:
+		b.ID = v
+	case string:
+		if oid, err := primitive.ObjectIDFromHex(v); err == nil {
+			b.ID = oid
+		}
+	}
+}
+
+func (b *ObjectIDModel) PrepareID(id interface{}) (interface{}, error) {
+	if s, ok := id.(string); ok {
+		return primitive.ObjectIDFromHex(s)
+	}
+	return id, nil
+}
+
+func (b *ObjectIDModel) GetID() interface{} {
+	return b.ID
+}
+
+func (b *ObjectIDModel) SetDeletedAt(deletedAt int64) {
+	b.DeletedAt = deletedAt
+}
+
+// UUIDModel alternative of BaseModel with random UUID string ids
+type UUIDModel struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	CreatedAt int64  `json:"created_at" bson:"created_at"`
+	UpdatedAt int64  `json:"updated_at" bson:"updated_at"`
+	DeletedAt int64  `json:"deleted_at" bson:"deleted_at"`
+}
+
+func (b *UUIDModel) Creating(_ context.Context) error {
+	b.CreatedAt = time.Now().Unix()
+	b.UpdatedAt = b.CreatedAt
+	if b.ID == "" {
+		b.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (b *UUIDModel) Updating(_ context.Context) error {
+	b.UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+func (b *UUIDModel) SetID(id interface{}) {
+	if s, ok := id.(string); ok {
+		b.ID = s
+	}
+}
+
+func (b *UUIDModel) PrepareID(id interface{}) (interface{}, error) {
+	if s, ok := id.(string); ok {
+		if _, err := uuid.Parse(s); err != nil {
+			return nil, err
+		}
+	}
+	return id, nil
+}
+
+func (b *UUIDModel) GetID() interface{} {
+	return b.ID
+}
+
+func (b *UUIDModel) SetDeletedAt(deletedAt int64) {
+	b.DeletedAt = deletedAt
+}
+
+func (b *BaseModel) SetDeletedAt(deletedAt int64) {
+	b.DeletedAt = deletedAt
+}
+
+// SoftDeletable models are marked deleted by SoftDelete
+type SoftDeletable interface {
+	mgm.Model
+	SetDeletedAt(deletedAt int64)
+}
+
+// NotDeleted adds the soft delete condition to filter, documents without deleted_at match too
+func NotDeleted(filter interface{}) interface{} {
+	notDeleted := bson.M{fieldDeletedAt: bson.M{"$in": bson.A{0, nil}}}
+	if filter == nil {
+		return notDeleted
+	}
+	return bson.M{"$and": bson.A{filter, notDeleted}}
+}
+
+// Find finds not deleted documents of model collection
+func Find(ctx context.Context, model mgm.Model, results interface{}, filter interface{}, opts ...*options.FindOptions) error {
+	return mgm.Coll(model).SimpleFindWithCtx(ctx, results, NotDeleted(filter), opts...)
+}
+
+// First finds the first not deleted document, mongo.ErrNoDocuments when there is none
+func First(ctx context.Context, model mgm.Model, filter interface{}, opts ...*options.FindOneOptions) error {
+	return mgm.Coll(model).FirstWithCtx(ctx, NotDeleted(filter), model, opts...)
+}
+
+// FindByID finds not deleted document by id, mongo.ErrNoDocuments when there is none
+func FindByID(ctx context.Context, id interface{}, model mgm.Model) error {
+	id, err := model.PrepareID(id)
+	if err != nil {
+		return err
+	}
+	return First(ctx, model, bson.M{"_id": id})
+}
+
+// Count counts not deleted documents
+func Count(ctx context.Context, model mgm.Model, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	return mgm.Coll(model).CountDocuments(ctx, NotDeleted(filter), opts...)
+}
+
+// SoftDelete marks model deleted now
+func SoftDelete(ctx context.Context, model SoftDeletable) error {
+	return setDeletedAt(ctx, model, time.Now().Unix())
+}
+
+// Restore clears the deleted mark of model
+func Restore(ctx context.Context, model SoftDeletable) error {
+	return setDeletedAt(ctx, model, 0)
+}
+
+func setDeletedAt(ctx context.Context, model SoftDeletable, deletedAt int64) error {
+	res, err := mgm.Coll(model).UpdateByID(ctx, model.GetID(), bson.M{"$set": bson.M{fieldDeletedAt: deletedAt}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	model.SetDeletedAt(deletedAt)
+	return nil
+}
+
+// IsNotFound reports mongo.ErrNoDocuments
+func IsNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
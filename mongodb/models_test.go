@@ -0,0 +1,99 @@
+package mongodb
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+func TestNotDeleted(t *testing.T) {
+	notDeleted := bson.M{fieldDeletedAt: bson.M{"$in": bson.A{0, nil}}}
+	tests := []struct {
+		name   string
+		filter interface{}
+		want   interface{}
+	}{
+		{name: "nil", want: notDeleted},
+		{name: "filter", filter: bson.M{"status": "active"}, want: bson.M{"$and": bson.A{bson.M{"status": "active"}, notDeleted}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NotDeleted(tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NotDeleted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectIDModel(t *testing.T) {
+	oid := primitive.NewObjectID()
+	tests := []struct {
+		name    string
+		id      interface{}
+		want    primitive.ObjectID
+		wantErr bool
+	}{
+		{name: "object id", id: oid, want: oid},
+		{name: "hex", id: oid.Hex(), want: oid},
+		{name: "invalid hex", id: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model ObjectIDModel
+			model.SetID(tt.id)
+			if model.ID != tt.want {
+				t.Errorf("SetID() ID = %s, want %s", model.ID.Hex(), tt.want.Hex())
+			}
+			prepared, err := model.PrepareID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PrepareID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && prepared != tt.want {
+				t.Errorf("PrepareID() = %v, want %s", prepared, tt.want.Hex())
+			}
+		})
+	}
+
+	var model ObjectIDModel
+	if err := model.Creating(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if model.ID.IsZero() || model.CreatedAt == 0 || model.UpdatedAt != model.CreatedAt {
+		t.Errorf("Creating() = %+v, want id and timestamps", model)
+	}
+}
+
+func TestUUIDModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      interface{}
+		wantErr bool
+	}{
+		{name: "uuid", id: "4f8a1c1e-3b7d-4a58-9a2e-1b2c3d4e5f60"},
+		{name: "invalid", id: "42", wantErr: true},
+		{name: "not a string", id: 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model UUIDModel
+			if _, err := model.PrepareID(tt.id); (err != nil) != tt.wantErr {
+				t.Errorf("PrepareID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	model := UUIDModel{ID: "kept"}
+	if err := model.Creating(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if model.ID != "kept" {
+		t.Errorf("Creating() replaced id %s", model.ID)
+	}
+	model = UUIDModel{}
+	_ = model.Creating(context.Background())
+	if len(model.ID) != 36 {
+		t.Errorf("Creating() id = %q, want uuid", model.ID)
+	}
+}
@@ -4,32 +4,64 @@ import (
 	"context"
 	"fmt"
 	"github.com/kamva/mgm/v3"
-	"github.com/uptrace/bun/migrate"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/zap"
 	"strconv"
 	"time"
 )
 
+const defaultOperationTimeout = 10 * time.Second
+
 type Mongodb struct {
+	Client     *mongo.Client
+	DB         *mongo.Database
 	Coll       func(m mgm.Model, opts ...*options.CollectionOptions) *mgm.Collection
 	Config     *Config
 	Logger     *zap.Logger
-	Migrations *migrate.Migrations
+	Migrations *Migrations
+
+	indexed       []Indexed
+	changeStreams changeStreams
 }
 
-func NewMongoDB(logger *zap.Logger, config *Config) *Mongodb {
-	logger.Debug("mongodb://" + config.User + ":" + config.Password + "@" + config.Host + "/" + config.Database + "?retryWrites=true&replicaSet=dbrs&readPreference=primary&connectTimeoutMS=10000&authSource=" + config.Database + "&authMechanism=SCRAM-SHA-1")
-	err := mgm.SetDefaultConfig(nil, config.Database, options.Client().ApplyURI("mongodb://"+config.User+":"+config.Password+"@"+config.Host+"/"+config.Database+"?retryWrites=true&replicaSet=dbrs&readPreference=primary&connectTimeoutMS=10000&authSource="+config.Database+"&authMechanism=SCRAM-SHA-1"))
+// NewMongoDB creates the client shared with mgm, the connection is checked by Ping on start
+func NewMongoDB(logger *zap.Logger, config *Config) (*Mongodb, error) {
+	opts, err := config.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	timeout := config.OperationTimeout
+	if timeout <= 0 {
+		timeout = defaultOperationTimeout
+	}
+	SetSequences(NewSequences(config.CounterCollection, config.IDBlockSize))
+	logger.Debug("connecting", zap.String("uri", config.Redacted()))
+	if err = mgm.SetDefaultConfig(&mgm.Config{CtxTimeout: timeout}, config.Database, opts); err != nil {
+		return nil, fmt.Errorf("mongodb client: %w", err)
+	}
+	_, client, db, err := mgm.DefaultConfigs()
 	if err != nil {
-		logger.Error(err.Error())
+		return nil, err
 	}
 	return &Mongodb{
+		Client: client,
+		DB:     db,
 		Config: config,
 		Logger: logger,
 		Coll:   mgm.Coll,
-	}
+	}, nil
+}
+
+// Ping checks connection to the primary
+func (m *Mongodb) Ping(ctx context.Context) error {
+	return m.Client.Ping(ctx, readpref.Primary())
+}
+
+// Close disconnects the client
+func (m *Mongodb) Close(ctx context.Context) error {
+	return m.Client.Disconnect(ctx)
 }
 
 type BaseModel struct {
@@ -39,30 +71,34 @@ type BaseModel struct {
 	DeletedAt int64 `json:"deleted_at" bson:"deleted_at"`
 }
 
+// Creating sets timestamps and the next id of collName sequence, call it before mgm Create
 func (b *BaseModel) Creating(collName string) error {
 	b.CreatedAt = time.Now().Unix()
-	b.UpdatedAt = time.Now().Unix()
-	var counter struct {
-		ID    string `bson:"_id"`
-		Value int64  `bson:"value"`
-	}
-	res := mgm.CollectionByName("counter").FindOneAndUpdate(context.Background(),
-		bson.D{{"_id", collName}},
-		bson.M{"$inc": bson.M{"value": 1}},
-		options.FindOneAndUpdate().SetUpsert(true),
-		options.FindOneAndUpdate().SetReturnDocument(options.After))
-	if err := res.Err(); err != nil {
-		return fmt.Errorf("failed to find one and update: %w", err)
-	}
-	if err := res.Decode(&counter); err != nil {
-		return fmt.Errorf("failed to decode counter: %w", err)
+	b.UpdatedAt = b.CreatedAt
+	id, err := sequences.Next(context.Background(), collName)
+	if err != nil {
+		return err
 	}
-	b.SetID(counter.Value)
+	b.SetID(id)
 	return nil
 }
 
+// SetID sets integer id, ids of other types are ignored
 func (b *BaseModel) SetID(id interface{}) {
-	b.ID = id.(int64)
+	switch v := id.(type) {
+	case int64:
+		b.ID = v
+	case int32:
+		b.ID = int64(v)
+	case int:
+		b.ID = int64(v)
+	case float64:
+		b.ID = int64(v)
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			b.ID = n
+		}
+	}
 }
 
 func (b *BaseModel) PrepareID(id interface{}) (interface{}, error) {
@@ -0,0 +1,89 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+)
+
+const (
+	defaultCounterCollection = "counter"
+	defaultIDBlockSize       = 1
+)
+
+// sequences allocator of BaseModel ids, configured by the mongodb module
+var sequences = NewSequences(defaultCounterCollection, defaultIDBlockSize)
+
+// Sequences allocates increasing ids stored in counter documents {_id: name, value: last reserved id}.
+// Every instance reserves blockSize ids per round trip, ids of a block left unused on restart are skipped,
+// so ids are unique and increasing per instance, but have gaps and are not ordered across instances.
+type Sequences struct {
+	collection string
+	blockSize  int64
+
+	mu     sync.Mutex
+	blocks map[string]*idBlock
+}
+
+type idBlock struct {
+	next int64
+	last int64
+}
+
+func NewSequences(collection string, blockSize int64) *Sequences {
+	if collection == "" {
+		collection = defaultCounterCollection
+	}
+	if blockSize < 1 {
+		blockSize = defaultIDBlockSize
+	}
+	return &Sequences{
+		collection: collection,
+		blockSize:  blockSize,
+		blocks:     make(map[string]*idBlock),
+	}
+}
+
+// SetSequences replaces the allocator used by BaseModel
+func SetSequences(s *Sequences) {
+	sequences = s
+}
+
+// Next returns the next id of sequence name
+func (s *Sequences) Next(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	block, ok := s.blocks[name]
+	if !ok || block.next > block.last {
+		last, err := s.reserve(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		block = &idBlock{next: last - s.blockSize + 1, last: last}
+		s.blocks[name] = block
+	}
+	id := block.next
+	block.next++
+	return id, nil
+}
+
+func (s *Sequences) reserve(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		ID    string `bson:"_id"`
+		Value int64  `bson:"value"`
+	}
+	res := mgm.CollectionByName(s.collection).FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.M{"$inc": bson.M{"value": s.blockSize}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+	if err := res.Err(); err != nil {
+		return 0, fmt.Errorf("failed to reserve %s ids: %w", name, err)
+	}
+	if err := res.Decode(&counter); err != nil {
+		return 0, fmt.Errorf("failed to decode counter: %w", err)
+	}
+	return counter.Value, nil
+}
@@ -0,0 +1,47 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewSequences(t *testing.T) {
+	tests := []struct {
+		name           string
+		collection     string
+		blockSize      int64
+		wantCollection string
+		wantBlockSize  int64
+	}{
+		{name: "defaults", wantCollection: defaultCounterCollection, wantBlockSize: defaultIDBlockSize},
+		{name: "negative block", collection: "ids", blockSize: -5, wantCollection: "ids", wantBlockSize: defaultIDBlockSize},
+		{name: "configured", collection: "ids", blockSize: 100, wantCollection: "ids", wantBlockSize: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSequences(tt.collection, tt.blockSize)
+			if s.collection != tt.wantCollection || s.blockSize != tt.wantBlockSize {
+				t.Errorf("NewSequences() = %s, %d, want %s, %d", s.collection, s.blockSize, tt.wantCollection, tt.wantBlockSize)
+			}
+		})
+	}
+}
+
+func TestSequencesNextFromBlock(t *testing.T) {
+	s := NewSequences("", 3)
+	// a reserved block is used without round trips to the counter collection
+	s.blocks["users"] = &idBlock{next: 4, last: 6}
+	s.blocks["orders"] = &idBlock{next: 10, last: 12}
+	for _, want := range []int64{4, 5, 6} {
+		got, err := s.Next(context.Background(), "users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Next() = %d, want %d", got, want)
+		}
+	}
+	if got, _ := s.Next(context.Background(), "orders"); got != 10 {
+		t.Errorf("Next() of another sequence = %d, want 10", got)
+	}
+}
@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"fmt"
+	"go.uber.org/config"
+	"time"
+)
+
+type Config struct {
+	// PollInterval delay between relay polls when there is nothing to deliver, 1s by default
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BatchSize events delivered per poll, 100 by default
+	BatchSize int `yaml:"batch_size"`
+	// MaxAttempts failed deliveries before the event is dead-lettered, 10 by default
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBackoff initial redelivery delay doubled on every attempt up to 10m, 1s by default
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	// PublishTimeout timeout of a single delivery, 10s by default
+	PublishTimeout time.Duration `yaml:"publish_timeout"`
+	// MqttQos qos of events published to mqtt
+	MqttQos byte `yaml:"mqtt_qos"`
+}
+
+func NewOutboxConfig(provider config.Provider) (*Config, error) {
+	cfg := Config{
+		PollInterval:   time.Second,
+		BatchSize:      100,
+		MaxAttempts:    10,
+		RetryBackoff:   time.Second,
+		PublishTimeout: 10 * time.Second,
+		MqttQos:        1,
+	}
+	if err := provider.Get("outbox").Populate(&cfg); err != nil {
+		return nil, fmt.Errorf("outbox config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"context"
+	"github.com/iwrk-platform/framework/postgres"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func NewModule() fx.Option {
+	return fx.Module(
+		"outbox",
+		fx.Provide(
+			NewOutboxConfig,
+			NewWriter,
+			NewRelay,
+		),
+		fx.Invoke(func(lc fx.Lifecycle, pg *postgres.Postgres, relay *Relay) {
+			pg.AddMigrations(Migration())
+			lc.Append(fx.Hook{
+				OnStart: func(ctx context.Context) error {
+					err := pg.Listener.Subscribe(ctx, NotifyChannel, func(_ context.Context, _ pgdriver.Notification) error {
+						relay.Notify()
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					pg.Listener.OnReconnect(func(_ context.Context) {
+						relay.Notify()
+					})
+					relay.Start()
+					return nil
+				},
+				OnStop: func(ctx context.Context) error {
+					return relay.Stop(ctx)
+				},
+			})
+		}),
+		fx.Decorate(func(log *zap.Logger) *zap.Logger {
+			return log.Named("outbox")
+		}),
+	)
+}
@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/goccy/go-json"
+	"github.com/iwrk-platform/framework/postgres"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+	"time"
+)
+
+type Destination string
+
+const (
+	DestinationMqtt     Destination = "mqtt"
+	DestinationTemporal Destination = "temporal"
+)
+
+var ErrNoTransaction = errors.New("outbox: events must be written inside a transaction")
+
+// Event message waiting for delivery. Events with the same AggregateKey are delivered in insert order,
+// a dead-lettered event holds the later events of its key back.
+type Event struct {
+	bun.BaseModel `bun:"table:outbox_events,alias:oe"`
+
+	ID            int64           `bun:",pk,autoincrement"`
+	AggregateKey  string          `bun:",notnull"`
+	Destination   Destination     `bun:",notnull"`
+	Topic         string          `bun:",notnull"` // mqtt topic or temporal workflow id
+	Name          string          `bun:",notnull"` // temporal signal name
+	Payload       json.RawMessage `bun:"type:jsonb,notnull"`
+	Attempts      int             `bun:",notnull"`
+	LastError     string          `bun:",nullzero"`
+	CreatedAt     time.Time       `bun:",nullzero,notnull,default:current_timestamp"`
+	NextAttemptAt time.Time       `bun:",nullzero,notnull,default:current_timestamp"`
+	DeadAt        time.Time       `bun:",nullzero"` // set when the event is dead-lettered
+}
+
+// NewMqttEvent creates event published to mqtt topic
+func NewMqttEvent(aggregateKey, topic string, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		AggregateKey: aggregateKey,
+		Destination:  DestinationMqtt,
+		Topic:        topic,
+		Payload:      data,
+	}, nil
+}
+
+// NewTemporalSignal creates event sent as signal to temporal workflow
+func NewTemporalSignal(aggregateKey, workflowID, signalName string, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		AggregateKey: aggregateKey,
+		Destination:  DestinationTemporal,
+		Topic:        workflowID,
+		Name:         signalName,
+		Payload:      data,
+	}, nil
+}
+
+// NotifyChannel postgres channel notified on commit of new events
+const NotifyChannel = "framework_outbox"
+
+// Writer stores events in the transaction of the caller
+type Writer struct {
+	pg *postgres.Postgres
+}
+
+func NewWriter(pg *postgres.Postgres) *Writer {
+	return &Writer{pg: pg}
+}
+
+// Add inserts events into the transaction started with Postgres.RunInTx
+func (w *Writer) Add(ctx context.Context, events ...*Event) error {
+	tx, ok := postgres.TxFromContext(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	return w.AddTx(ctx, tx, events...)
+}
+
+// AddTx inserts events into tx
+func (w *Writer) AddTx(ctx context.Context, tx bun.Tx, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if _, err := tx.NewInsert().Model(&events).Exec(ctx); err != nil {
+		return err
+	}
+	// wakes relays of all instances up on commit
+	_, err := tx.ExecContext(ctx, "SELECT pg_notify(?, '')", NotifyChannel)
+	return err
+}
+
+// Migration creates the outbox table, registered to the postgres module by the outbox module
+func Migration() migrate.Migration {
+	return migrate.Migration{
+		Name:    "20240801000000",
+		Comment: "framework_outbox",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS outbox_events (
+	id bigserial PRIMARY KEY,
+	aggregate_key text NOT NULL,
+	destination text NOT NULL,
+	topic text NOT NULL,
+	name text NOT NULL DEFAULT '',
+	payload jsonb NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text,
+	created_at timestamptz NOT NULL DEFAULT current_timestamp,
+	next_attempt_at timestamptz NOT NULL DEFAULT current_timestamp,
+	dead_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS outbox_events_key_idx ON outbox_events (aggregate_key, id);
+`)
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS outbox_events`)
+			return err
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/iwrk-platform/framework/mqtt"
+	"github.com/iwrk-platform/framework/postgres"
+	"github.com/iwrk-platform/framework/temporal"
+	"github.com/uptrace/bun"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	maxRetryBackoff = 10 * time.Minute
+	// claimMargin is added to the time a batch may take to publish, see claimTimeout
+	claimMargin = time.Minute
+)
+
+// Publisher delivers events of one destination
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+type PublisherFunc func(ctx context.Context, event *Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+type RelayParams struct {
+	fx.In
+
+	Postgres *postgres.Postgres
+	Config   *Config
+	Logger   *zap.Logger
+	Mqtt     *mqtt.MQTT         `optional:"true"`
+	Temporal *temporal.Temporal `optional:"true"`
+}
+
+// Relay delivers outbox events at least once. Only the oldest event of each aggregate key is taken,
+// so events of one key are delivered in order, a failing event blocks its key until it is delivered
+// and a dead-lettered one until it is moved back with RetryDead or deleted.
+type Relay struct {
+	pg         *postgres.Postgres
+	config     *Config
+	logger     *zap.Logger
+	publishers map[Destination]Publisher
+	wake       chan struct{}
+	done       chan struct{}
+	stopped    chan struct{}
+	// ctx of in-flight deliveries, Stop cancels it and claimed events are released
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewRelay(params RelayParams) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{
+		pg:         params.Postgres,
+		config:     params.Config,
+		logger:     params.Logger,
+		publishers: make(map[Destination]Publisher),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	if params.Mqtt != nil {
+		r.AddPublisher(DestinationMqtt, NewMqttPublisher(params.Mqtt, params.Config.MqttQos))
+	}
+	if params.Temporal != nil {
+		r.AddPublisher(DestinationTemporal, NewTemporalPublisher(params.Temporal))
+	}
+	return r
+}
+
+// AddPublisher sets publisher of destination, custom destinations are allowed
+func (r *Relay) AddPublisher(destination Destination, publisher Publisher) {
+	r.publishers[destination] = publisher
+}
+
+// Notify wakes the relay up before the poll interval passes
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Relay) Start() {
+	go r.run()
+}
+
+func (r *Relay) Stop(ctx context.Context) error {
+	close(r.done)
+	r.cancel()
+	select {
+	case <-r.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Relay) run() {
+	defer close(r.stopped)
+	for {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		delivered, err := r.DeliverBatch(r.ctx)
+		if err != nil && r.ctx.Err() == nil {
+			r.logger.Error("outbox delivery failed", zap.Error(err))
+		}
+		if delivered > 0 {
+			continue
+		}
+		select {
+		case <-r.done:
+			return
+		case <-r.wake:
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// DeliverBatch delivers up to BatchSize due events and returns the number of processed events.
+// Events are claimed in a short transaction and published outside of it, events of a relay that
+// died while publishing are redelivered once their claim expires.
+func (r *Relay) DeliverBatch(ctx context.Context) (int, error) {
+	events, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, event := range events {
+		if err = r.deliver(ctx, event); err != nil {
+			// the rest of the batch is due again, the relay is stopping or the database is unavailable
+			return i, errors.Join(err, r.release(context.WithoutCancel(ctx), events[i:]))
+		}
+	}
+	return len(events), nil
+}
+
+// claim locks due events and moves their next attempt past the batch, so other relays skip them
+func (r *Relay) claim(ctx context.Context) ([]*Event, error) {
+	events := make([]*Event, 0)
+	err := r.pg.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().Model(&events).
+			Where("oe.dead_at IS NULL").
+			Where("oe.next_attempt_at <= current_timestamp").
+			// dead events are counted, so a dead-lettered event keeps the later events of its key back
+			Where("oe.id = (SELECT min(f.id) FROM outbox_events AS f WHERE f.aggregate_key = oe.aggregate_key)").
+			OrderExpr("oe.id").
+			Limit(r.config.BatchSize).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		_, err = tx.NewUpdate().Model((*Event)(nil)).
+			Set("next_attempt_at = ?", time.Now().Add(r.claimTimeout())).
+			Where("id IN (?)", bun.In(eventIDs(events))).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// claimTimeout covers publishing of a whole batch, every publish is limited by PublishTimeout
+func (r *Relay) claimTimeout() time.Duration {
+	return time.Duration(r.config.BatchSize)*r.config.PublishTimeout + claimMargin
+}
+
+// release makes claimed events due again
+func (r *Relay) release(ctx context.Context, events []*Event) error {
+	_, err := r.pg.DB.NewUpdate().Model((*Event)(nil)).
+		Set("next_attempt_at = current_timestamp").
+		Where("id IN (?)", bun.In(eventIDs(events))).
+		Exec(ctx)
+	return err
+}
+
+func eventIDs(events []*Event) []int64 {
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func (r *Relay) deliver(ctx context.Context, event *Event) error {
+	errPublish := r.publish(ctx, event)
+	if errPublish == nil {
+		_, err := r.pg.DB.NewDelete().Model(event).WherePK().Exec(ctx)
+		return err
+	}
+	if ctx.Err() != nil {
+		// the relay is stopping, the attempt is not counted
+		return ctx.Err()
+	}
+
+	event.Attempts++
+	event.LastError = errPublish.Error()
+	backoff := r.config.RetryBackoff << min(event.Attempts-1, 20)
+	if backoff <= 0 || backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	event.NextAttemptAt = time.Now().Add(backoff)
+	logger := r.logger.With(zap.Int64("id", event.ID), zap.String("aggregate_key", event.AggregateKey), zap.Int("attempts", event.Attempts))
+	if event.Attempts >= r.config.MaxAttempts {
+		event.DeadAt = time.Now()
+		logger.Error("outbox event dead-lettered", zap.Error(errPublish))
+	} else {
+		logger.Warn("outbox event delivery failed", zap.Error(errPublish))
+	}
+	_, err := r.pg.DB.NewUpdate().Model(event).
+		Column("attempts", "last_error", "next_attempt_at", "dead_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+func (r *Relay) publish(ctx context.Context, event *Event) error {
+	publisher, ok := r.publishers[event.Destination]
+	if !ok {
+		return fmt.Errorf("no publisher for destination %q", event.Destination)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.PublishTimeout)
+	defer cancel()
+	return publisher.Publish(ctx, event)
+}
+
+// RetryDead moves dead-lettered events of aggregateKey (all when empty) back to delivery. Later events
+// of a key are kept back while it has a dead event, so the retried event is still delivered first.
+func (r *Relay) RetryDead(ctx context.Context, aggregateKey string) (int64, error) {
+	query := r.pg.DB.NewUpdate().Model((*Event)(nil)).
+		Set("dead_at = NULL").
+		Set("attempts = 0").
+		Set("next_attempt_at = current_timestamp").
+		Where("dead_at IS NOT NULL")
+	if aggregateKey != "" {
+		query = query.Where("aggregate_key = ?", aggregateKey)
+	}
+	res, err := query.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// NewMqttPublisher publishes event payload to the event topic
+func NewMqttPublisher(mq *mqtt.MQTT, qos byte) Publisher {
+	return PublisherFunc(func(ctx context.Context, event *Event) error {
+		token := mq.Client.Publish(event.Topic, qos, false, []byte(event.Payload))
+		select {
+		case <-token.Done():
+			return token.Error()
+		case <-ctx.Done():
+			return errors.Join(errors.New("mqtt publish timeout"), ctx.Err())
+		}
+	})
+}
+
+// NewTemporalPublisher signals workflow with id event.Topic, signal event.Name
+func NewTemporalPublisher(tm *temporal.Temporal) Publisher {
+	return PublisherFunc(func(ctx context.Context, event *Event) error {
+		var payload any
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		return tm.Client.SignalWorkflow(ctx, event.Topic, "", event.Name, payload)
+	})
+}
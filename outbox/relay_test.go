@@ -0,0 +1,245 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/iwrk-platform/framework/postgres"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConnector records statements and answers the event select with rows, it stands in for Postgres
+type fakeConnector struct {
+	mu         sync.Mutex
+	statements []string
+	// events rows of the select of due events
+	events [][]driver.Value
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+func (c *fakeConnector) record(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, query)
+}
+
+type fakeConn struct{ c *fakeConnector }
+
+func (f fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (f fakeConn) Close() error                        { return nil }
+func (f fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (f fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	f.c.record("BEGIN")
+	return fakeTx{f.c}, nil
+}
+
+func (f fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	f.c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (f fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	f.c.record(query)
+	rows := &fakeRows{columns: eventColumns}
+	if strings.HasPrefix(query, "SELECT") {
+		rows.rows = f.c.events
+	}
+	return rows, nil
+}
+
+type fakeTx struct{ c *fakeConnector }
+
+func (t fakeTx) Commit() error   { t.c.record("COMMIT"); return nil }
+func (t fakeTx) Rollback() error { t.c.record("ROLLBACK"); return nil }
+
+var eventColumns = []string{"id", "aggregate_key", "destination", "topic", "name", "payload", "attempts",
+	"last_error", "created_at", "next_attempt_at", "dead_at"}
+
+// eventRow returns row of a pending event
+func eventRow(id int64, key string, attempts int64) []driver.Value {
+	return []driver.Value{id, key, "test", "topic", "", []byte(`{}`), attempts, nil, nil, nil, nil}
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func fakeRelay(connector *fakeConnector, publish PublisherFunc) *Relay {
+	pg := &postgres.Postgres{DB: bun.NewDB(sql.OpenDB(connector), pgdialect.New())}
+	r := NewRelay(RelayParams{
+		Postgres: pg,
+		Config:   &Config{BatchSize: 10, MaxAttempts: 3, RetryBackoff: time.Second, PublishTimeout: time.Second},
+		Logger:   zap.NewNop(),
+	})
+	r.AddPublisher("test", publish)
+	return r
+}
+
+func TestDeliverBatch(t *testing.T) {
+	errPublish := errors.New("broker is down")
+	tests := []struct {
+		name   string
+		events [][]driver.Value
+		// publish fails events of the keys
+		failing map[string]bool
+		// want substrings of statements in order
+		want          []string
+		wantDelivered int
+	}{
+		{
+			name: "no events",
+			want: []string{"BEGIN", "SELECT", "COMMIT"},
+		},
+		{
+			name:   "delivered",
+			events: [][]driver.Value{eventRow(1, "a", 0), eventRow(2, "b", 0)},
+			want: []string{
+				"BEGIN", "SELECT", `UPDATE "outbox_events" AS "oe" SET next_attempt_at = '`, "COMMIT",
+				`DELETE FROM "outbox_events" AS "oe" WHERE ("oe"."id" = 1)`,
+				`DELETE FROM "outbox_events" AS "oe" WHERE ("oe"."id" = 2)`,
+			},
+			wantDelivered: 2,
+		},
+		{
+			name:    "failed attempt",
+			events:  [][]driver.Value{eventRow(1, "a", 0)},
+			failing: map[string]bool{"a": true},
+			want: []string{
+				"BEGIN", "SELECT", "UPDATE", "COMMIT",
+				`SET "attempts" = 1, "last_error" = 'broker is down', "next_attempt_at" = '`,
+			},
+			wantDelivered: 1,
+		},
+		{
+			name:    "dead-lettered",
+			events:  [][]driver.Value{eventRow(1, "a", 2), eventRow(2, "b", 0)},
+			failing: map[string]bool{"a": true},
+			want: []string{
+				"BEGIN", "SELECT", "UPDATE", "COMMIT",
+				`SET "attempts" = 3, "last_error" = 'broker is down', "next_attempt_at" = '`,
+				`DELETE FROM "outbox_events" AS "oe" WHERE ("oe"."id" = 2)`,
+			},
+			wantDelivered: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &fakeConnector{events: tt.events}
+			r := fakeRelay(connector, func(_ context.Context, event *Event) error {
+				if tt.failing[event.AggregateKey] {
+					return errPublish
+				}
+				return nil
+			})
+			delivered, err := r.DeliverBatch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if delivered != tt.wantDelivered {
+				t.Errorf("DeliverBatch() = %d, want %d", delivered, tt.wantDelivered)
+			}
+			got := connector.statements
+			if len(got) != len(tt.want) {
+				t.Fatalf("DeliverBatch() statements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("statement %d = %s, want %s", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDeliverBatchDeadLetter(t *testing.T) {
+	connector := &fakeConnector{events: [][]driver.Value{eventRow(1, "a", 2)}}
+	r := fakeRelay(connector, func(context.Context, *Event) error { return errors.New("rejected") })
+	if _, err := r.DeliverBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	update := connector.statements[len(connector.statements)-1]
+	if !strings.Contains(update, `"dead_at" = '`) {
+		t.Errorf("update of the last attempt = %s, want dead_at set", update)
+	}
+
+	connector = &fakeConnector{events: [][]driver.Value{eventRow(1, "a", 0)}}
+	r = fakeRelay(connector, func(context.Context, *Event) error { return errors.New("rejected") })
+	if _, err := r.DeliverBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	update = connector.statements[len(connector.statements)-1]
+	if !strings.Contains(update, `"dead_at" = NULL`) {
+		t.Errorf("update of a retried attempt = %s, want dead_at NULL", update)
+	}
+}
+
+func TestDeliverBatchSelection(t *testing.T) {
+	connector := &fakeConnector{}
+	r := fakeRelay(connector, func(context.Context, *Event) error { return nil })
+	if _, err := r.DeliverBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	query := connector.statements[1]
+	for _, want := range []string{
+		`(oe.dead_at IS NULL)`,
+		`oe.next_attempt_at <= current_timestamp`,
+		// dead events are not excluded from the oldest event of the key, so they block it
+		`oe.id = (SELECT min(f.id) FROM outbox_events AS f WHERE f.aggregate_key = oe.aggregate_key)`,
+		`ORDER BY oe.id LIMIT 10 FOR UPDATE SKIP LOCKED`,
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("select = %s, want %s", query, want)
+		}
+	}
+}
+
+func TestDeliverBatchStopped(t *testing.T) {
+	connector := &fakeConnector{events: [][]driver.Value{eventRow(1, "a", 0), eventRow(2, "b", 0)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := fakeRelay(connector, func(ctx context.Context, _ *Event) error {
+		cancel()
+		return ctx.Err()
+	})
+	delivered, err := r.DeliverBatch(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DeliverBatch() error = %v, want %v", err, context.Canceled)
+	}
+	if delivered != 0 {
+		t.Errorf("DeliverBatch() = %d, want 0", delivered)
+	}
+	// the interrupted attempt is not counted and the claimed events are due again
+	release := connector.statements[len(connector.statements)-1]
+	want := `UPDATE "outbox_events" AS "oe" SET next_attempt_at = current_timestamp WHERE (id IN (1, 2))`
+	if release != want {
+		t.Errorf("statement = %s, want %s", release, want)
+	}
+	for _, statement := range connector.statements {
+		if strings.Contains(statement, `"attempts" =`) {
+			t.Errorf("attempt of a stopped relay is counted: %s", statement)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -15,11 +16,16 @@ func NewModule() fx.Option {
 		),
 		fx.Invoke(func(lc fx.Lifecycle, pg *Postgres) {
 			lc.Append(fx.Hook{
-				OnStart: func(_ context.Context) error {
-					return pg.StartMigrations()
+				OnStart: func(ctx context.Context) error {
+					if err := pg.StartMigrations(ctx); err != nil {
+						return err
+					}
+					go pg.Replicas.Monitor(pg.Config.ReplicaCheckInterval, pg.Done, pg.Logger)
+					return pg.Listener.Start(ctx)
 				},
 				OnStop: func(ctx context.Context) error {
-					return pg.Conn.Close()
+					close(pg.Done)
+					return errors.Join(pg.Listener.Stop(ctx), pg.Close())
 				},
 			})
 		}),
@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"go.uber.org/zap"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultListenerPingInterval = 30 * time.Second
+	listenerPingChannel         = "framework_listener_ping"
+	maxListenerBackoff          = 30 * time.Second
+)
+
+// NotificationHandler handles notification of a subscribed channel
+type NotificationHandler func(ctx context.Context, notification pgdriver.Notification) error
+
+// Listener receives LISTEN/NOTIFY notifications on a dedicated connection and dispatches them to
+// handlers of their channel. Handlers run one by one in the receiving goroutine, so they should be fast.
+// Broken connections are replaced and channels are listened again, notifications sent while
+// the listener was disconnected are lost, OnReconnect handlers may catch up on them.
+type Listener struct {
+	db           *bun.DB
+	logger       *zap.Logger
+	pingInterval time.Duration
+
+	mu          sync.Mutex
+	ln          *pgdriver.Listener
+	handlers    map[string][]NotificationHandler
+	onReconnect []func(ctx context.Context)
+	started     bool
+	closed      bool
+	running     bool
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+func NewListener(db *bun.DB, logger *zap.Logger, pingInterval time.Duration) *Listener {
+	if pingInterval <= 0 {
+		pingInterval = defaultListenerPingInterval
+	}
+	return &Listener{
+		db:           db,
+		logger:       logger,
+		pingInterval: pingInterval,
+		handlers:     make(map[string][]NotificationHandler),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Subscribe adds handler of channel. Subscriptions made before start are listened on start,
+// later ones are listened immediately.
+func (l *Listener) Subscribe(ctx context.Context, channel string, handler NotificationHandler) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, listened := l.handlers[channel]
+	l.handlers[channel] = append(l.handlers[channel], handler)
+	if !l.started || l.closed || listened {
+		return nil
+	}
+	if !l.running {
+		return l.start(ctx)
+	}
+	if err := l.ln.Listen(ctx, channel); err != nil {
+		return fmt.Errorf("listen %s: %w", channel, err)
+	}
+	return nil
+}
+
+// SubscribeJSON adds handler of channel receiving JSON payloads decoded into T
+func SubscribeJSON[T any](ctx context.Context, l *Listener, channel string, handler func(ctx context.Context, payload T) error) error {
+	return l.Subscribe(ctx, channel, func(ctx context.Context, notification pgdriver.Notification) error {
+		var payload T
+		if notification.Payload != "" {
+			if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+				return fmt.Errorf("decode %s payload: %w", channel, err)
+			}
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// OnReconnect adds fn called after the connection was restored
+func (l *Listener) OnReconnect(fn func(ctx context.Context)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReconnect = append(l.onReconnect, fn)
+}
+
+// Start listens subscribed channels and starts receiving notifications, the connection
+// is not opened until there is a subscription
+func (l *Listener) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.started || l.closed {
+		return nil
+	}
+	l.started = true
+	if len(l.handlers) == 0 {
+		return nil
+	}
+	return l.start(ctx)
+}
+
+func (l *Listener) start(ctx context.Context) error {
+	ln, err := l.listen(ctx)
+	if err != nil {
+		return err
+	}
+	l.ln = ln
+	l.running = true
+	go l.run()
+	return nil
+}
+
+// Stop closes the listener connection and waits for the running handler
+func (l *Listener) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	l.closed = true
+	if !l.running {
+		l.mu.Unlock()
+		return nil
+	}
+	l.running = false
+	close(l.done)
+	err := l.ln.Close()
+	l.mu.Unlock()
+
+	select {
+	case <-l.stopped:
+		return err
+	case <-ctx.Done():
+		return errors.Join(err, ctx.Err())
+	}
+}
+
+// listen opens a listener connection subscribed to all channels, must be called with mu held
+func (l *Listener) listen(ctx context.Context) (*pgdriver.Listener, error) {
+	channels := []string{listenerPingChannel}
+	for channel := range l.handlers {
+		channels = append(channels, channel)
+	}
+	ln := pgdriver.NewListener(l.db)
+	if err := ln.Listen(ctx, channels...); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return ln, nil
+}
+
+func (l *Listener) run() {
+	defer close(l.stopped)
+	ctx := context.Background()
+	pinged := false
+	for attempt := 0; ; {
+		l.mu.Lock()
+		ln := l.ln
+		l.mu.Unlock()
+
+		channel, payload, err := ln.ReceiveTimeout(ctx, l.pingInterval)
+		if l.isStopped() {
+			return
+		}
+		switch {
+		case err == nil:
+			pinged = false
+			attempt = 0
+			if channel != listenerPingChannel {
+				l.dispatch(ctx, pgdriver.Notification{Channel: channel, Payload: payload})
+			}
+		case isTimeout(err) && !pinged:
+			// nothing was received for a while, the ping notification must come back through a healthy connection
+			pinged = true
+			if err = pgdriver.Notify(ctx, l.db, listenerPingChannel, ""); err != nil {
+				l.logger.Warn("listener ping failed", zap.Error(err))
+			}
+		default:
+			if isTimeout(err) {
+				err = errors.New("ping notification was not received")
+			}
+			l.logger.Warn("listener connection lost", zap.Error(err), zap.Int("attempt", attempt+1))
+			if !l.wait(listenerBackoff(attempt)) {
+				return
+			}
+			attempt++
+			if l.reconnect(ctx) {
+				pinged = false
+				attempt = 0
+			}
+		}
+	}
+}
+
+// reconnect replaces the listener connection and listens all channels again
+func (l *Listener) reconnect(ctx context.Context) bool {
+	l.mu.Lock()
+	if !l.running {
+		l.mu.Unlock()
+		return false
+	}
+	ln, err := l.listen(ctx)
+	if err != nil {
+		l.mu.Unlock()
+		l.logger.Warn("listener reconnect failed", zap.Error(err))
+		return false
+	}
+	_ = l.ln.Close()
+	l.ln = ln
+	hooks := append([]func(ctx context.Context){}, l.onReconnect...)
+	l.mu.Unlock()
+
+	l.logger.Info("listener reconnected")
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+	return true
+}
+
+func (l *Listener) dispatch(ctx context.Context, notification pgdriver.Notification) {
+	l.mu.Lock()
+	handlers := l.handlers[notification.Channel]
+	l.mu.Unlock()
+	for _, handler := range handlers {
+		if err := handler(ctx, notification); err != nil {
+			l.logger.Error("notification handler failed", zap.String("channel", notification.Channel), zap.Error(err))
+		}
+	}
+}
+
+func (l *Listener) isStopped() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait sleeps for d and reports false when the listener was stopped meanwhile
+func (l *Listener) wait(d time.Duration) bool {
+	select {
+	case <-l.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Notify sends notification with JSON encoded payload, inside RunInTx it is delivered on commit
+func (p *Postgres) Notify(ctx context.Context, channel string, payload any) error {
+	data := ""
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("encode %s payload: %w", channel, err)
+		}
+		data = string(b)
+	}
+	_, err := p.IDB(ctx).ExecContext(ctx, "SELECT pg_notify(?, ?)", channel, data)
+	return err
+}
+
+func listenerBackoff(attempt int) time.Duration {
+	d := time.Second << min(attempt, 5)
+	return min(d, maxListenerBackoff)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestListenerBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: time.Second},
+		{attempt: 1, want: 2 * time.Second},
+		{attempt: 4, want: 16 * time.Second},
+		{attempt: 5, want: maxListenerBackoff},
+		{attempt: 100, want: maxListenerBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			if got := listenerBackoff(tt.attempt); got != tt.want {
+				t.Errorf("listenerBackoff() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "deadline", err: fmt.Errorf("receive: %w", os.ErrDeadlineExceeded), want: true},
+		{name: "other", err: errors.New("connection reset")},
+		{name: "nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTimeout(tt.err); got != tt.want {
+				t.Errorf("isTimeout() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeJSON(t *testing.T) {
+	type payload struct {
+		ID int `json:"id"`
+	}
+	tests := []struct {
+		name    string
+		payload string
+		want    []payload
+	}{
+		{name: "json", payload: `{"id":7}`, want: []payload{{ID: 7}}},
+		{name: "empty", payload: "", want: []payload{{}}},
+		{name: "invalid", payload: "{", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// subscriptions before start do not open the connection
+			l := NewListener(nil, zap.NewNop(), 0)
+			var got []payload
+			err := SubscribeJSON(context.Background(), l, "orders", func(_ context.Context, p payload) error {
+				got = append(got, p)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.dispatch(context.Background(), pgdriver.Notification{Channel: "orders", Payload: tt.payload})
+			l.dispatch(context.Background(), pgdriver.Notification{Channel: "other", Payload: tt.payload})
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("handled payloads = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLockRetryInterval = time.Second
+	defaultLockCheckInterval = 5 * time.Second
+)
+
+var ErrLockNotHeld = errors.New("postgres: advisory lock is not held")
+
+// LockKey maps lock name to the advisory lock key
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// Lock session level advisory lock held on a dedicated connection. The lock is released by Unlock
+// or when the connection breaks, Lost is closed in the second case and the work it protects must stop.
+type Lock struct {
+	Name string
+	Key  int64
+
+	conn   bun.Conn
+	logger *zap.Logger
+	lost   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+// TryLock acquires lock name without waiting, the second result is false when it is held by another session
+func (p *Postgres) TryLock(ctx context.Context, name string) (*Lock, bool, error) {
+	conn, err := p.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock %s: %w", name, err)
+	}
+	key := LockKey(name)
+	var acquired bool
+	if err = conn.NewRaw("SELECT pg_try_advisory_lock(?)", key).Scan(ctx, &acquired); err != nil {
+		// the lock may be taken by the session even though the result is lost
+		_ = discardConn(conn)
+		return nil, false, fmt.Errorf("lock %s: %w", name, err)
+	}
+	if !acquired {
+		return nil, false, conn.Close()
+	}
+	lock := &Lock{
+		Name:   name,
+		Key:    key,
+		conn:   conn,
+		logger: p.Logger.With(zap.String("lock", name)),
+		lost:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	checkInterval := p.Config.LockCheckInterval
+	if checkInterval <= 0 {
+		checkInterval = defaultLockCheckInterval
+	}
+	lock.wg.Add(1)
+	go lock.monitor(checkInterval)
+	return lock, true, nil
+}
+
+// Lock waits until lock name is acquired or ctx is done
+func (p *Postgres) Lock(ctx context.Context, name string) (*Lock, error) {
+	retryInterval := p.lockRetryInterval()
+	for {
+		lock, acquired, err := p.TryLock(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// WithLock runs fn holding lock name, ctx of fn is cancelled when the lock is lost
+func (p *Postgres) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	lock, err := p.Lock(ctx, name)
+	if err != nil {
+		return err
+	}
+	lockCtx, cancel := lock.Context(ctx)
+	defer cancel()
+	err = fn(lockCtx)
+	return errors.Join(err, lock.Unlock(context.WithoutCancel(ctx)))
+}
+
+func (p *Postgres) lockRetryInterval() time.Duration {
+	if p.Config.LockRetryInterval > 0 {
+		return p.Config.LockRetryInterval
+	}
+	return defaultLockRetryInterval
+}
+
+// Lost is closed when the lock session broke and the lock may be taken by another instance
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Context returns ctx cancelled when the lock is lost
+func (l *Lock) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-l.lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Unlock releases the lock and its connection, it returns ErrLockNotHeld when the lock was lost
+func (l *Lock) Unlock(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+		select {
+		case <-l.lost:
+			err = ErrLockNotHeld
+		default:
+			var released bool
+			if err = l.conn.NewRaw("SELECT pg_advisory_unlock(?)", l.Key).Scan(ctx, &released); err == nil && !released {
+				err = ErrLockNotHeld
+			}
+		}
+		if err != nil {
+			// the session may still hold the lock, returning it to the pool would hand the lock to the next borrower
+			err = errors.Join(err, l.discard())
+			return
+		}
+		err = l.conn.Close()
+	})
+	return err
+}
+
+// discard closes the physical connection of the lock instead of returning it to the pool
+func (l *Lock) discard() error {
+	return discardConn(l.conn)
+}
+
+func discardConn(conn bun.Conn) error {
+	err := conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return nil
+	}
+	return err
+}
+
+// monitor checks the lock session is alive, the lock lives as long as its connection
+func (l *Lock) monitor(interval time.Duration) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			_, err := l.conn.ExecContext(ctx, "SELECT 1")
+			cancel()
+			if err != nil {
+				l.logger.Warn("advisory lock session lost", zap.Error(err))
+				if err = l.discard(); err != nil {
+					l.logger.Warn("advisory lock connection discard failed", zap.Error(err))
+				}
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// LeaderCallbacks of LeaderElection
+type LeaderCallbacks struct {
+	// OnAcquire is called when this instance became the leader, ctx is cancelled when leadership
+	// is lost or the election stops. It may block running the leader job.
+	OnAcquire func(ctx context.Context)
+	// OnLose is called after OnAcquire returned and leadership ended
+	OnLose func()
+}
+
+// LeaderElection keeps trying to take advisory lock name, so exactly one instance runs the leader job.
+// Start and Stop it from fx lifecycle hooks of the worker.
+type LeaderElection struct {
+	pg        *Postgres
+	name      string
+	callbacks LeaderCallbacks
+
+	mu      sync.Mutex
+	leader  bool
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func (p *Postgres) NewLeaderElection(name string, callbacks LeaderCallbacks) *LeaderElection {
+	return &LeaderElection{
+		pg:        p,
+		name:      name,
+		callbacks: callbacks,
+		stopped:   make(chan struct{}),
+	}
+}
+
+// IsLeader reports whether this instance holds the leadership
+func (e *LeaderElection) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *LeaderElection) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	go e.run(ctx)
+	return nil
+}
+
+// Stop cancels the leader job and releases leadership
+func (e *LeaderElection) Stop(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *LeaderElection) run(ctx context.Context) {
+	defer close(e.stopped)
+	for {
+		lock, err := e.pg.Lock(ctx, e.name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			e.pg.Logger.Warn("leader election failed", zap.String("election", e.name), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.pg.lockRetryInterval()):
+			}
+			continue
+		}
+		e.lead(ctx, lock)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (e *LeaderElection) lead(ctx context.Context, lock *Lock) {
+	e.pg.Logger.Info("leadership acquired", zap.String("election", e.name))
+	e.setLeader(true)
+
+	leaderCtx, cancel := lock.Context(ctx)
+	if e.callbacks.OnAcquire != nil {
+		e.callbacks.OnAcquire(leaderCtx)
+	}
+	<-leaderCtx.Done()
+	cancel()
+
+	e.setLeader(false)
+	if err := lock.Unlock(context.Background()); err != nil && !errors.Is(err, ErrLockNotHeld) {
+		e.pg.Logger.Warn("leader unlock failed", zap.String("election", e.name), zap.Error(err))
+	}
+	e.pg.Logger.Info("leadership lost", zap.String("election", e.name))
+	if e.callbacks.OnLose != nil {
+		e.callbacks.OnLose()
+	}
+}
+
+func (e *LeaderElection) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	if LockKey("jobs") != LockKey("jobs") {
+		t.Error("LockKey() differs for the same name")
+	}
+	if LockKey("jobs") == LockKey("reports") {
+		t.Error("LockKey() is the same for different names")
+	}
+}
+
+// fakeLocks answers advisory lock queries with acquired and released, queries fail with errQuery
+func fakeLocks(acquired, released bool, errQuery error) *fakeConnector {
+	return &fakeConnector{rows: func(query string) ([]string, [][]driver.Value, error) {
+		if errQuery != nil {
+			return nil, nil, errQuery
+		}
+		switch {
+		case strings.HasPrefix(query, "SELECT pg_try_advisory_lock"):
+			return []string{"pg_try_advisory_lock"}, [][]driver.Value{{acquired}}, nil
+		case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+			return []string{"pg_advisory_unlock"}, [][]driver.Value{{released}}, nil
+		}
+		return nil, nil, errors.New("unexpected query " + query)
+	}}
+}
+
+func TestTryLock(t *testing.T) {
+	errQuery := errors.New("connection reset")
+	tests := []struct {
+		name         string
+		connector    *fakeConnector
+		wantAcquired bool
+		// wantUnlockErr is the error of Unlock of the acquired lock
+		wantUnlockErr error
+		// wantClosed connections discarded instead of returned to the pool
+		wantClosed int
+		wantErr    bool
+	}{
+		{name: "acquired", connector: fakeLocks(true, true, nil), wantAcquired: true},
+		{name: "held by another session", connector: fakeLocks(false, false, nil)},
+		{name: "lock query failed", connector: fakeLocks(true, true, errQuery), wantClosed: 1, wantErr: true},
+		{name: "not released", connector: fakeLocks(true, false, nil), wantAcquired: true, wantUnlockErr: ErrLockNotHeld, wantClosed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fakePostgres(tt.connector)
+			p.Config.LockCheckInterval = time.Hour
+			lock, acquired, err := p.TryLock(context.Background(), "jobs")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TryLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if acquired != tt.wantAcquired {
+				t.Fatalf("TryLock() acquired = %t, want %t", acquired, tt.wantAcquired)
+			}
+			if acquired {
+				if err = lock.Unlock(context.Background()); !errors.Is(err, tt.wantUnlockErr) {
+					t.Errorf("Unlock() error = %v, want %v", err, tt.wantUnlockErr)
+				}
+			}
+			if got := tt.connector.closedConns(); got != tt.wantClosed {
+				t.Errorf("closed connections = %d, want %d", got, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	connector := fakeLocks(true, true, nil)
+	connector.exec = func(query string) error {
+		if query == "SELECT 1" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	p := fakePostgres(connector)
+	lock, acquired, err := p.TryLock(context.Background(), "jobs")
+	if err != nil || !acquired {
+		t.Fatalf("TryLock() = %t, %v", acquired, err)
+	}
+	ctx, cancel := lock.Context(context.Background())
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lock context is not cancelled when the session is lost")
+	}
+	if err = lock.Unlock(context.Background()); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Unlock() error = %v, want %v", err, ErrLockNotHeld)
+	}
+	// the session may still hold the lock, so its connection must not go back to the pool
+	if got := connector.closedConns(); got != 1 {
+		t.Errorf("closed connections = %d, want 1", got)
+	}
+	for _, statement := range connector.log() {
+		if strings.HasPrefix(statement, "SELECT pg_advisory_unlock") {
+			t.Error("lost lock is unlocked on a broken session")
+		}
+	}
+}
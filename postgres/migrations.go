@@ -0,0 +1,255 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun/migrate"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	migrationsTable = "bun_migrations"
+	// migrationsLockRetry interval of lock attempts while another instance migrates
+	migrationsLockRetry = time.Second
+)
+
+var migrationFileRE = regexp.MustCompile(`^(\d{1,14})_([0-9a-z_\-]+)\.(tx\.)?up\.sql$`)
+
+type MigrationsStatus struct {
+	Applied   migrate.MigrationSlice
+	Pending   migrate.MigrationSlice
+	LastGroup *migrate.MigrationGroup
+}
+
+func (s *MigrationsStatus) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("applied: %d, pending: %d, last group: %s\n", len(s.Applied), len(s.Pending), s.LastGroup))
+	for _, m := range s.Applied {
+		sb.WriteString(fmt.Sprintf("  [x] %s (group %d, %s)\n", m, m.GroupID, m.MigratedAt.Format("2006-01-02 15:04:05")))
+	}
+	for _, m := range s.Pending {
+		sb.WriteString(fmt.Sprintf("  [ ] %s\n", m))
+	}
+	return sb.String()
+}
+
+// UseMigrations sets migrations applied on start. SQL migrations (*.up.sql, *.down.sql, *.tx.up.sql)
+// are discovered from fsys and added to Go migrations already registered in migrations, both may be nil.
+func (p *Postgres) UseMigrations(migrations *migrate.Migrations, fsys fs.FS) error {
+	if migrations == nil {
+		migrations = migrate.NewMigrations()
+	}
+	if fsys != nil {
+		if err := migrations.Discover(fsys); err != nil {
+			return fmt.Errorf("discover migrations: %w", err)
+		}
+	}
+	p.Migrations = migrations
+	p.MigrationsFS = fsys
+	return nil
+}
+
+// AddMigrations adds migrations owned by framework modules (outbox, locks...) to the service ones
+func (p *Postgres) AddMigrations(migrations ...migrate.Migration) {
+	p.moduleMigrations = append(p.moduleMigrations, migrations...)
+}
+
+// Migrator returns bun migrator over the service and module migrations
+func (p *Postgres) Migrator() *migrate.Migrator {
+	return migrate.NewMigrator(p.DB, p.allMigrations(), migrate.WithTableName(migrationsTable))
+}
+
+func (p *Postgres) allMigrations() *migrate.Migrations {
+	migrations := migrate.NewMigrations()
+	for _, m := range p.moduleMigrations {
+		migrations.Add(m)
+	}
+	if p.Migrations != nil {
+		for _, m := range p.Migrations.Sorted() {
+			migrations.Add(m)
+		}
+	}
+	return migrations
+}
+
+// StartMigrations applies pending migrations, any init, lock or migration error fails the start.
+// While another instance holds the lock it waits until ctx is done.
+func (p *Postgres) StartMigrations(ctx context.Context) error {
+	if p.Migrations == nil && len(p.moduleMigrations) == 0 {
+		return nil
+	}
+	group, err := p.MigrateUp(ctx)
+	if err != nil {
+		return err
+	}
+	if group.IsZero() {
+		p.Logger.Info("there are no new migrations to run (database is up to date)")
+		return nil
+	}
+	p.Logger.Info("migrated", zap.String("group", group.String()))
+	return nil
+}
+
+// MigrateUp applies all pending migrations as a new group
+func (p *Postgres) MigrateUp(ctx context.Context) (*migrate.MigrationGroup, error) {
+	var group *migrate.MigrationGroup
+	err := p.withMigrationsLock(ctx, func(m *migrate.Migrator) error {
+		var err error
+		group, err = m.Migrate(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return group, nil
+}
+
+// MigrateDown rolls back the last applied group
+func (p *Postgres) MigrateDown(ctx context.Context) (*migrate.MigrationGroup, error) {
+	var group *migrate.MigrationGroup
+	err := p.withMigrationsLock(ctx, func(m *migrate.Migrator) error {
+		var err error
+		group, err = m.Rollback(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rollback: %w", err)
+	}
+	return group, nil
+}
+
+// MarkMigrationsApplied records pending migrations as applied without running them
+func (p *Postgres) MarkMigrationsApplied(ctx context.Context) (*migrate.MigrationGroup, error) {
+	var group *migrate.MigrationGroup
+	err := p.withMigrationsLock(ctx, func(m *migrate.Migrator) error {
+		var err error
+		group, err = m.Migrate(ctx, migrate.WithNopMigration())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mark applied: %w", err)
+	}
+	return group, nil
+}
+
+// MigrationsStatus returns applied and pending migrations, it does not create the migrations tables,
+// so all migrations are pending in a database which was never migrated
+func (p *Postgres) MigrationsStatus(ctx context.Context) (*MigrationsStatus, error) {
+	var initialized bool
+	if err := p.DB.NewRaw("SELECT to_regclass(?) IS NOT NULL", migrationsTable).Scan(ctx, &initialized); err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+	if !initialized {
+		return &MigrationsStatus{
+			Applied:   migrate.MigrationSlice{},
+			Pending:   p.allMigrations().Sorted(),
+			LastGroup: migrate.MigrationSlice{}.LastGroup(),
+		}, nil
+	}
+	ms, err := p.Migrator().MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+	return &MigrationsStatus{
+		Applied:   ms.Applied(),
+		Pending:   ms.Unapplied(),
+		LastGroup: ms.LastGroup(),
+	}, nil
+}
+
+// PendingMigrationsSQL writes SQL of pending migrations to w without applying them
+func (p *Postgres) PendingMigrationsSQL(ctx context.Context, w io.Writer) error {
+	status, err := p.MigrationsStatus(ctx)
+	if err != nil {
+		return err
+	}
+	files, err := p.migrationFiles()
+	if err != nil {
+		return err
+	}
+	for _, m := range status.Pending {
+		if _, err = fmt.Fprintf(w, "-- %s\n", m); err != nil {
+			return err
+		}
+		file, ok := files[m.Name]
+		if !ok {
+			if _, err = io.WriteString(w, "-- go migration, SQL is not available\n\n"); err != nil {
+				return err
+			}
+			continue
+		}
+		content, err := fs.ReadFile(p.MigrationsFS, file)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "%s\n", content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) withMigrationsLock(ctx context.Context, fn func(m *migrate.Migrator) error) (err error) {
+	m := p.Migrator()
+	if err = m.Init(ctx); err != nil {
+		return fmt.Errorf("init migrations: %w", err)
+	}
+	if err = lockMigrations(ctx, m); err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+	// unlock in defer so a panicking migration does not leave the lock behind
+	defer func() {
+		if errUnlock := m.Unlock(context.WithoutCancel(ctx)); errUnlock != nil {
+			err = errors.Join(err, fmt.Errorf("unlock migrations: %w", errUnlock))
+		}
+	}()
+	return fn(m)
+}
+
+// lockMigrations waits for the lock held by another instance, bun Lock fails at once when it is taken.
+// The lock is a row of the locks table, so only a unique violation means it is held, other errors are returned.
+func lockMigrations(ctx context.Context, m *migrate.Migrator) error {
+	for {
+		err := m.Lock(ctx)
+		if err == nil || !isUniqueViolation(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(migrationsLockRetry):
+		}
+	}
+}
+
+func isUniqueViolation(err error) bool {
+	return sqlState(err) == "23505"
+}
+
+// migrationFiles maps migration names to their up SQL file in MigrationsFS
+func (p *Postgres) migrationFiles() (map[string]string, error) {
+	files := make(map[string]string)
+	if p.MigrationsFS == nil {
+		return files, nil
+	}
+	err := fs.WalkDir(p.MigrationsFS, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if matches := migrationFileRE.FindStringSubmatch(path.Base(file)); matches != nil {
+			files[matches[1]] = file
+		}
+		return nil
+	})
+	return files, err
+}
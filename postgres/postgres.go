@@ -3,63 +3,116 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
 	"github.com/uptrace/bun/migrate"
 	"go.uber.org/zap"
+	"io/fs"
+	"strconv"
 )
 
 type Postgres struct {
-	Conn       bun.Conn
-	DB         *bun.DB
-	Config     *Config
-	Logger     *zap.Logger
-	Migrations *migrate.Migrations
-	Done       chan struct{}
+	DB           *bun.DB
+	Replicas     *ReplicaRouter
+	Listener     *Listener
+	Config       *Config
+	Logger       *zap.Logger
+	Migrations   *migrate.Migrations
+	MigrationsFS fs.FS
+	Done         chan struct{}
+
+	moduleMigrations []migrate.Migration
 }
 
-func NewPostgres(logger *zap.Logger, config *Config) *Postgres {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", config.User, config.Password, config.Host, config.Port, config.Database)
-	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
-	dbConn, err := db.Conn(context.Background())
+func NewPostgres(logger *zap.Logger, config *Config) (*Postgres, error) {
+	db, err := openDB(config.DSN(), config)
 	if err != nil {
-		logger.Error(err.Error())
+		return nil, err
 	}
-	return &Postgres{
-		DB:     db,
-		Config: config,
-		Logger: logger,
-		Conn:   dbConn,
-		Done:   make(chan struct{}),
+	replicas := make([]*bun.DB, 0, len(config.Replicas))
+	for i, dsn := range config.Replicas {
+		replica, err := openDB(dsn, config)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		replicas = append(replicas, replica)
 	}
+	return &Postgres{
+		DB:       db,
+		Replicas: NewReplicaRouter(db, replicas...),
+		Listener: NewListener(db, logger, config.ListenerPingInterval),
+		Config:   config,
+		Logger:   logger,
+		Done:     make(chan struct{}),
+	}, nil
+}
+
+// ReadDB returns a healthy replica or the primary database when there are none. Reads are not
+// routed automatically, queries of DB, RunInTx and repositories always go to the primary.
+func (p *Postgres) ReadDB() *bun.DB {
+	return p.Replicas.DB()
+}
+
+// Ping checks connection to the primary database
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.DB.PingContext(ctx)
+}
+
+// Close closes primary and replica connection pools
+func (p *Postgres) Close() error {
+	return errors.Join(p.DB.Close(), p.Replicas.Close())
 }
 
-func (p *Postgres) StartMigrations() error {
-	if p.Migrations == nil {
-		return nil
+// openDB opens bun database from dsn with timeouts and pool settings of config, dsn parameters take precedence
+func openDB(dsn string, config *Config) (db *bun.DB, err error) {
+	// pgdriver panics on invalid DSN (unsupported sslmode, unreadable CA file)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("postgres dsn: %v", r)
+		}
+	}()
+	sqlDB := sql.OpenDB(newConnector(dsn, config))
+	if config.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(config.MaxOpenConns)
 	}
-	mgrtr := migrate.NewMigrator(p.DB, p.Migrations)
-	err := mgrtr.Init(context.Background())
-	if err != nil {
-		p.Logger.Error(err.Error())
+	if config.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(config.MaxIdleConns)
 	}
-	if err := mgrtr.Lock(context.Background()); err != nil {
-		p.Logger.Error(err.Error())
+	if config.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
 	}
-	group, err := mgrtr.Migrate(context.Background())
-	if err != nil {
-		p.Logger.Warn(err.Error())
-		mgrtr.Unlock(context.Background())
-		return err
+	if config.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	}
+	return bun.NewDB(sqlDB, pgdialect.New()), nil
+}
+
+// newConnector returns connector of dsn with timeouts of config, dsn parameters take precedence.
+// Session parameters of dsn replace ConnParams, so statement_timeout is merged into them afterwards.
+func newConnector(dsn string, config *Config) *pgdriver.Connector {
+	opts := make([]pgdriver.Option, 0)
+	if config.DialTimeout > 0 {
+		opts = append(opts, pgdriver.WithDialTimeout(config.DialTimeout))
+	}
+	if config.ReadTimeout > 0 {
+		opts = append(opts, pgdriver.WithReadTimeout(config.ReadTimeout))
+	}
+	if config.WriteTimeout > 0 {
+		opts = append(opts, pgdriver.WithWriteTimeout(config.WriteTimeout))
 	}
-	if group.IsZero() {
-		p.Logger.Warn("there are no new migrations to run (database is up to date)")
-		mgrtr.Unlock(context.Background())
-		return nil
+	opts = append(opts, pgdriver.WithDSN(dsn))
+	if config.StatementTimeout > 0 {
+		opts = append(opts, func(cfg *pgdriver.Config) {
+			params := make(map[string]interface{}, len(cfg.ConnParams)+1)
+			params["statement_timeout"] = strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)
+			for key, value := range cfg.ConnParams {
+				params[key] = value
+			}
+			cfg.ConnParams = params
+		})
 	}
-	p.Logger.Info(fmt.Sprintf("migrated to %s\\n", group))
-	mgrtr.Unlock(context.Background())
-	return nil
+	return pgdriver.NewConnector(opts...)
 }
@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewConnectorParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsn     string
+		timeout time.Duration
+		want    map[string]interface{}
+	}{
+		{
+			name:    "statement timeout",
+			dsn:     "postgres://user@localhost/db",
+			timeout: 5 * time.Second,
+			want:    map[string]interface{}{"statement_timeout": "5000"},
+		},
+		{
+			name:    "merged with dsn params",
+			dsn:     "postgres://user@localhost/db?search_path=app",
+			timeout: 5 * time.Second,
+			want:    map[string]interface{}{"statement_timeout": "5000", "search_path": "app"},
+		},
+		{
+			name:    "dsn takes precedence",
+			dsn:     "postgres://user@localhost/db?statement_timeout=100",
+			timeout: 5 * time.Second,
+			want:    map[string]interface{}{"statement_timeout": "100"},
+		},
+		{
+			name: "dsn params only",
+			dsn:  "postgres://user@localhost/db?search_path=app",
+			want: map[string]interface{}{"search_path": "app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := newConnector(tt.dsn, &Config{StatementTimeout: tt.timeout})
+			if got := connector.Config().ConnParams; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConnParams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+const defaultReplicaCheckInterval = 10 * time.Second
+
+type replica struct {
+	db      *bun.DB
+	healthy atomic.Bool
+}
+
+// ReplicaRouter is an explicit read handle: queries built with it or on DB go to healthy replicas
+// with round robin and fall back to the primary database. Nothing else is routed, queries of
+// Postgres.DB, including ones which must see own writes or run inside a transaction, use the primary.
+type ReplicaRouter struct {
+	primary  *bun.DB
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+func NewReplicaRouter(primary *bun.DB, replicas ...*bun.DB) *ReplicaRouter {
+	r := &ReplicaRouter{
+		primary:  primary,
+		replicas: make([]*replica, 0, len(replicas)),
+	}
+	for _, db := range replicas {
+		rp := &replica{db: db}
+		rp.healthy.Store(true)
+		r.replicas = append(r.replicas, rp)
+	}
+	return r
+}
+
+// DB returns next healthy replica or the primary database
+func (r *ReplicaRouter) DB() *bun.DB {
+	n := len(r.replicas)
+	if n == 0 {
+		return r.primary
+	}
+	start := r.next.Add(1)
+	for i := 0; i < n; i++ {
+		rp := r.replicas[(start+uint64(i))%uint64(n)]
+		if rp.healthy.Load() {
+			return rp.db
+		}
+	}
+	return r.primary
+}
+
+func (r *ReplicaRouter) NewSelect() *bun.SelectQuery {
+	return r.DB().NewSelect()
+}
+
+func (r *ReplicaRouter) NewRaw(query string, args ...interface{}) *bun.RawQuery {
+	return r.DB().NewRaw(query, args...)
+}
+
+// Check pings replicas and excludes unavailable ones from routing until they answer again
+func (r *ReplicaRouter) Check(ctx context.Context) error {
+	var errs []error
+	for i, rp := range r.replicas {
+		if err := rp.db.PingContext(ctx); err != nil {
+			rp.healthy.Store(false)
+			errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+			continue
+		}
+		rp.healthy.Store(true)
+	}
+	return errors.Join(errs...)
+}
+
+// Monitor checks replicas every interval until done is closed
+func (r *ReplicaRouter) Monitor(interval time.Duration, done <-chan struct{}, logger *zap.Logger) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := r.Check(ctx); err != nil {
+				logger.Warn("replica check failed", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Close closes replica connection pools
+func (r *ReplicaRouter) Close() error {
+	var errs []error
+	for _, rp := range r.replicas {
+		errs = append(errs, rp.db.Close())
+	}
+	return errors.Join(errs...)
+}
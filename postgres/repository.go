@@ -0,0 +1,354 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// AuditUserKey context key of the authenticated user id written to created_by and updated_by columns.
+// With fiber set it by ctx.Locals(AuditUserKey, id) and pass ctx.Context() down.
+const AuditUserKey = "userId"
+
+var (
+	ErrNotFound     = errors.New("postgres: entity not found")
+	ErrStaleVersion = errors.New("postgres: entity was changed by another request")
+)
+
+const (
+	columnVersion   = "version"
+	columnCreatedBy = "created_by"
+	columnCreatedAt = "created_at"
+	columnUpdatedBy = "updated_by"
+	columnUpdatedAt = "updated_at"
+)
+
+// ContextWithUser returns context carrying the user id for audit columns
+func ContextWithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, AuditUserKey, userID)
+}
+
+// UserFromContext returns the user id for audit columns
+func UserFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(AuditUserKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+type Filter struct {
+	Column string
+	// Op one of =, !=, <>, >, >=, <, <=, in, not in, like, ilike, is null, is not null
+	Op    string
+	Value any
+}
+
+type ListOptions struct {
+	Filters []Filter
+	// Sort column names, "-" prefix for descending order
+	Sort        []string
+	Limit       int
+	Offset      int
+	WithDeleted bool
+}
+
+// Repository common queries of bun model T. Queries join the transaction of ctx (see RunInTx).
+// Columns with conventional names get special handling:
+// version - optimistic locking, created_by and updated_by - user from ctx, updated_at - update time,
+// soft deletes use bun soft_delete tag.
+type Repository[T any] struct {
+	pg        *Postgres
+	table     *schema.Table
+	pk        *schema.Field
+	version   *schema.Field
+	createdBy *schema.Field
+	updatedBy *schema.Field
+	updatedAt *schema.Field
+}
+
+func NewRepository[T any](pg *Postgres) (*Repository[T], error) {
+	table := pg.DB.Table(reflect.TypeOf((*T)(nil)).Elem())
+	if len(table.PKs) != 1 {
+		return nil, fmt.Errorf("repository model %s must have exactly one primary key", table.TypeName)
+	}
+	version := table.LookupField(columnVersion)
+	if version != nil && !isInteger(version.StructField.Type.Kind()) {
+		return nil, fmt.Errorf("repository model %s: version must be an integer field", table.TypeName)
+	}
+	return &Repository[T]{
+		pg:        pg,
+		table:     table,
+		pk:        table.PKs[0],
+		version:   version,
+		createdBy: table.LookupField(columnCreatedBy),
+		updatedBy: table.LookupField(columnUpdatedBy),
+		updatedAt: table.LookupField(columnUpdatedAt),
+	}, nil
+}
+
+// NewSelect starts select of T joined to the transaction of ctx
+func (r *Repository[T]) NewSelect(ctx context.Context, model any) *bun.SelectQuery {
+	return r.pg.IDB(ctx).NewSelect().Model(model)
+}
+
+// Find returns entity by primary key or ErrNotFound, integer ids of any Go integer type are accepted
+func (r *Repository[T]) Find(ctx context.Context, id any) (*T, error) {
+	item := new(T)
+	if err := r.setID(reflect.ValueOf(item).Elem(), id); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+	if err := r.NewSelect(ctx, item).WherePK().Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// List returns a page of entities and the total count matched by filters
+func (r *Repository[T]) List(ctx context.Context, opts ListOptions) ([]T, int, error) {
+	items := make([]T, 0)
+	query := r.NewSelect(ctx, &items)
+	if opts.WithDeleted {
+		query = query.WhereAllWithDeleted()
+	}
+	for _, filter := range opts.Filters {
+		if !r.table.HasField(filter.Column) {
+			return nil, 0, fmt.Errorf("unknown filter column %s", filter.Column)
+		}
+		where, args, err := filterExpr(filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		query = query.Where(where, args...)
+	}
+	for _, sort := range opts.Sort {
+		column, direction := strings.TrimPrefix(sort, "-"), "ASC"
+		if strings.HasPrefix(sort, "-") {
+			direction = "DESC"
+		}
+		if !r.table.HasField(column) {
+			return nil, 0, fmt.Errorf("unknown sort column %s", column)
+		}
+		query = query.OrderExpr("?TableAlias.? "+direction, bun.Ident(column))
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		query = query.Offset(opts.Offset)
+	}
+	total, err := query.ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// Create inserts entity and scans generated columns back
+func (r *Repository[T]) Create(ctx context.Context, item *T) error {
+	v := reflect.ValueOf(item).Elem()
+	if user := UserFromContext(ctx); user != "" {
+		if err := r.setField(v, r.createdBy, user); err != nil {
+			return err
+		}
+		if err := r.setField(v, r.updatedBy, user); err != nil {
+			return err
+		}
+	}
+	if r.version != nil && r.version.HasZeroValue(v) {
+		if err := setInteger(r.version.Value(v), 1); err != nil {
+			return err
+		}
+	}
+	_, err := r.pg.IDB(ctx).NewInsert().Model(item).Returning("*").Exec(ctx)
+	return err
+}
+
+// Update saves entity, with version column it fails with ErrStaleVersion when the row
+// was updated after entity was read
+func (r *Repository[T]) Update(ctx context.Context, item *T) error {
+	v := reflect.ValueOf(item).Elem()
+	if err := r.setField(v, r.updatedBy, UserFromContext(ctx)); err != nil {
+		return err
+	}
+	if err := r.setField(v, r.updatedAt, time.Now()); err != nil {
+		return err
+	}
+	query := r.pg.IDB(ctx).NewUpdate().Model(item).WherePK()
+	if r.createdBy != nil {
+		query = query.ExcludeColumn(columnCreatedBy)
+	}
+	if r.table.HasField(columnCreatedAt) {
+		query = query.ExcludeColumn(columnCreatedAt)
+	}
+	var version int64
+	if r.version != nil {
+		version, _ = integerValue(r.version.Value(v))
+		query = query.Where("?TableAlias.? = ?", bun.Ident(columnVersion), version)
+		if err := setInteger(r.version.Value(v), version+1); err != nil {
+			return err
+		}
+	}
+	res, err := query.Exec(ctx)
+	if err == nil {
+		err = checkAffected(res)
+	}
+	if err != nil {
+		if r.version != nil {
+			_ = setInteger(r.version.Value(v), version)
+			if errors.Is(err, ErrNotFound) {
+				err = ErrStaleVersion
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes entity, models with bun soft_delete field are only marked as deleted
+func (r *Repository[T]) Delete(ctx context.Context, item *T) error {
+	if r.table.SoftDeleteField != nil && r.updatedBy != nil {
+		if user := UserFromContext(ctx); user != "" {
+			v := reflect.ValueOf(item).Elem()
+			if err := r.setField(v, r.updatedBy, user); err != nil {
+				return err
+			}
+			if _, err := r.pg.IDB(ctx).NewUpdate().Model(item).Column(columnUpdatedBy).WherePK().Exec(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	res, err := r.pg.IDB(ctx).NewDelete().Model(item).WherePK().Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// ForceDelete removes entity even if the model supports soft delete
+func (r *Repository[T]) ForceDelete(ctx context.Context, item *T) error {
+	res, err := r.pg.IDB(ctx).NewDelete().Model(item).WherePK().ForceDelete().Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// Restore clears soft delete mark of entity
+func (r *Repository[T]) Restore(ctx context.Context, item *T) error {
+	if r.table.SoftDeleteField == nil {
+		return fmt.Errorf("model %s does not support soft delete", r.table.TypeName)
+	}
+	v := reflect.ValueOf(item).Elem()
+	if err := r.table.SoftDeleteField.ScanValue(v, nil); err != nil {
+		return err
+	}
+	res, err := r.pg.IDB(ctx).NewUpdate().Model(item).
+		Column(r.table.SoftDeleteField.Name).
+		WherePK().
+		WhereAllWithDeleted().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+func (r *Repository[T]) setField(v reflect.Value, field *schema.Field, value any) error {
+	if field == nil {
+		return nil
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return nil
+	}
+	return field.ScanValue(v, value)
+}
+
+// setID sets primary key of entity, integer ids are converted to the key field type
+func (r *Repository[T]) setID(v reflect.Value, id any) error {
+	field := r.pk.Value(v)
+	if n, ok := integerValue(reflect.ValueOf(id)); ok && isInteger(field.Kind()) {
+		return setInteger(field, n)
+	}
+	return r.pk.ScanValue(v, id)
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// integerValue returns value of signed or unsigned integer, false for other kinds and uint64 above MaxInt64
+func integerValue(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+// setInteger sets signed or unsigned integer field, values which do not fit the field are rejected
+func setInteger(field reflect.Value, n int64) error {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, field.Type())
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n < 0 || field.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%d overflows %s", n, field.Type())
+		}
+		field.SetUint(uint64(n))
+	default:
+		return fmt.Errorf("%s is not an integer", field.Type())
+	}
+	return nil
+}
+
+func checkAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func filterExpr(filter Filter) (string, []any, error) {
+	column := bun.Ident(filter.Column)
+	switch op := strings.ToLower(strings.TrimSpace(filter.Op)); op {
+	case "", "=":
+		return "?TableAlias.? = ?", []any{column, filter.Value}, nil
+	case "!=", "<>", ">", ">=", "<", "<=":
+		return "?TableAlias.? " + op + " ?", []any{column, filter.Value}, nil
+	case "like", "ilike":
+		return "?TableAlias.? " + strings.ToUpper(op) + " ?", []any{column, filter.Value}, nil
+	case "in", "not in":
+		return "?TableAlias.? " + strings.ToUpper(op) + " (?)", []any{column, bun.In(filter.Value)}, nil
+	case "is null", "is not null":
+		return "?TableAlias.? " + strings.ToUpper(op), []any{column}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported filter operator %s", filter.Op)
+	}
+}
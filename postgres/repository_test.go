@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"reflect"
+	"testing"
+)
+
+type testUser struct {
+	ID      uint32 `bun:",pk"`
+	Version uint64
+}
+
+type testCode struct {
+	Code string `bun:",pk"`
+}
+
+type testStringVersion struct {
+	ID      int64 `bun:",pk"`
+	Version string
+}
+
+func testPostgres() *Postgres {
+	// the connector does not connect until a query is run
+	return &Postgres{DB: bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())}
+}
+
+func TestRepositorySetID(t *testing.T) {
+	users, err := NewRepository[testUser](testPostgres())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		id      any
+		want    uint32
+		wantErr bool
+	}{
+		{name: "int", id: 1, want: 1},
+		{name: "int64", id: int64(2), want: 2},
+		{name: "uint8", id: uint8(3), want: 3},
+		{name: "string", id: "4", want: 4},
+		{name: "negative", id: -1, wantErr: true},
+		{name: "overflow", id: int64(1) << 40, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := testUser{}
+			err := users.setID(reflect.ValueOf(&item).Elem(), tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if item.ID != tt.want {
+				t.Errorf("setID() id = %d, want %d", item.ID, tt.want)
+			}
+		})
+	}
+
+	codes, err := NewRepository[testCode](testPostgres())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := testCode{}
+	if err = codes.setID(reflect.ValueOf(&code).Elem(), "ru"); err != nil || code.Code != "ru" {
+		t.Errorf("setID() code = %q, error = %v", code.Code, err)
+	}
+}
+
+func TestRepositoryVersion(t *testing.T) {
+	if _, err := NewRepository[testStringVersion](testPostgres()); err == nil {
+		t.Error("NewRepository() with string version must fail")
+	}
+	users, err := NewRepository[testUser](testPostgres())
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := testUser{Version: 7}
+	version := users.version.Value(reflect.ValueOf(&item).Elem())
+	n, ok := integerValue(version)
+	if !ok || n != 7 {
+		t.Fatalf("integerValue() = %d, %v, want 7", n, ok)
+	}
+	if err = setInteger(version, n+1); err != nil || item.Version != 8 {
+		t.Errorf("setInteger() version = %d, error = %v", item.Version, err)
+	}
+}
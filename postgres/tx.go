@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultTxMaxRetries   = 3
+	defaultTxRetryBackoff = 50 * time.Millisecond
+)
+
+type txContextKey struct{}
+
+type txContext struct {
+	tx          bun.Tx
+	afterCommit []func(ctx context.Context) error
+}
+
+// TxFromContext returns the transaction started by RunInTx
+func TxFromContext(ctx context.Context) (bun.Tx, bool) {
+	if txCtx, ok := ctx.Value(txContextKey{}).(*txContext); ok {
+		return txCtx.tx, true
+	}
+	return bun.Tx{}, false
+}
+
+// IDB returns the transaction of ctx or the database, repositories build queries on it
+// to join the caller transaction transparently
+func (p *Postgres) IDB(ctx context.Context) bun.IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return p.DB
+}
+
+// AfterCommit registers fn to run after the outermost transaction of ctx commits, for example
+// to publish events only for persisted changes. Without transaction fn runs immediately.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context) error) error {
+	if txCtx, ok := ctx.Value(txContextKey{}).(*txContext); ok {
+		txCtx.afterCommit = append(txCtx.afterCommit, fn)
+		return nil
+	}
+	return fn(ctx)
+}
+
+// RunInTx runs fn in a transaction stored in the fn context. Nested calls run in a savepoint of the
+// outer transaction. The outermost transaction is retried with backoff on serialization failures
+// and deadlocks, so fn must not have side effects other than queries, use AfterCommit for them.
+func (p *Postgres) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if parent, ok := ctx.Value(txContextKey{}).(*txContext); ok {
+		return parent.tx.RunInTx(ctx, opts, func(ctx context.Context, tx bun.Tx) error {
+			nested := &txContext{tx: tx}
+			if err := fn(context.WithValue(ctx, txContextKey{}, nested)); err != nil {
+				return err
+			}
+			// hooks of a rolled back savepoint are dropped with it
+			parent.afterCommit = append(parent.afterCommit, nested.afterCommit...)
+			return nil
+		})
+	}
+
+	maxRetries := p.Config.TxMaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultTxMaxRetries
+	}
+	backoff := p.Config.TxRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultTxRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		txCtx := &txContext{}
+		err := p.DB.RunInTx(ctx, opts, func(ctx context.Context, tx bun.Tx) error {
+			txCtx.tx = tx
+			return fn(context.WithValue(ctx, txContextKey{}, txCtx))
+		})
+		if err == nil {
+			p.runAfterCommit(ctx, txCtx.afterCommit)
+			return nil
+		}
+		if !IsRetryableTxError(err) || attempt >= maxRetries {
+			return err
+		}
+		delay := backoff<<attempt + time.Duration(rand.Int63n(int64(backoff)))
+		p.Logger.Debug("retrying transaction", zap.Int("attempt", attempt+1), zap.Duration("delay", delay), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p *Postgres) runAfterCommit(ctx context.Context, hooks []func(ctx context.Context) error) {
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			p.Logger.Error("after commit hook failed", zap.Error(err))
+		}
+	}
+}
+
+// IsRetryableTxError reports serialization failures and deadlocks
+func IsRetryableTxError(err error) bool {
+	switch sqlState(err) {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+// sqlState returns SQLSTATE code of a server error like pgdriver.Error, empty for other errors
+func sqlState(err error) string {
+	var pgErr interface{ Field(k byte) string }
+	if !errors.As(err, &pgErr) {
+		return ""
+	}
+	return pgErr.Field('C')
+}
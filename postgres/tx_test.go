@@ -0,0 +1,306 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConnector records statements and answers queries with canned rows, it stands in for Postgres
+type fakeConnector struct {
+	mu         sync.Mutex
+	statements []string
+	closed     int
+	// exec returns error of a statement including COMMIT, nil when it is not set
+	exec func(query string) error
+	// rows returns columns and rows of a query
+	rows func(query string) ([]string, [][]driver.Value, error)
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c: c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+// record adds statement to the log, savepoint names are random, so they are cut
+func (c *fakeConnector) record(query string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, prefix := range []string{"SAVEPOINT", "RELEASE SAVEPOINT", "ROLLBACK TO SAVEPOINT"} {
+		if strings.HasPrefix(query, prefix+" ") {
+			query = prefix
+		}
+	}
+	c.statements = append(c.statements, query)
+	if c.exec != nil {
+		return c.exec(query)
+	}
+	return nil
+}
+
+func (c *fakeConnector) log() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.statements...)
+}
+
+func (c *fakeConnector) closedConns() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+type fakeConn struct{ c *fakeConnector }
+
+func (f *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (f *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (f *fakeConn) Close() error {
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+	f.c.closed++
+	return nil
+}
+
+func (f *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if err := f.c.record("BEGIN"); err != nil {
+		return nil, err
+	}
+	return fakeTx{f.c}, nil
+}
+
+func (f *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := f.c.record(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (f *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := f.c.record(query); err != nil {
+		return nil, err
+	}
+	if f.c.rows == nil {
+		return &fakeRows{}, nil
+	}
+	columns, rows, err := f.c.rows(query)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeTx struct{ c *fakeConnector }
+
+func (t fakeTx) Commit() error   { return t.c.record("COMMIT") }
+func (t fakeTx) Rollback() error { return t.c.record("ROLLBACK") }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// fakeError server error with SQLSTATE code like pgdriver.Error
+type fakeError struct{ code string }
+
+func (e fakeError) Error() string { return "ERROR #" + e.code }
+
+func (e fakeError) Field(k byte) string {
+	if k == 'C' {
+		return e.code
+	}
+	return ""
+}
+
+func fakePostgres(connector *fakeConnector) *Postgres {
+	return &Postgres{
+		DB:     bun.NewDB(sql.OpenDB(connector), pgdialect.New()),
+		Config: &Config{TxRetryBackoff: time.Millisecond, LockCheckInterval: time.Millisecond},
+		Logger: zap.NewNop(),
+	}
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "serialization failure", err: fakeError{"40001"}, want: true},
+		{name: "deadlock", err: fakeError{"40P01"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("update: %w", fakeError{"40001"}), want: true},
+		{name: "unique violation", err: fakeError{"23505"}},
+		{name: "not a server error", err: errors.New("40001")},
+		{name: "nil", err: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableTxError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableTxError() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunInTx(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name string
+		// fn runs in the transaction, it adds AfterCommit hooks writing "hook" statements
+		fn func(p *Postgres, ctx context.Context, attempt int) error
+		// exec fails statements of the fake connection
+		exec    func(query string) error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "after commit",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				return AfterCommit(ctx, hook(p, "hook"))
+			},
+			want: []string{"BEGIN", "COMMIT", "hook"},
+		},
+		{
+			name: "rolled back",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				if err := AfterCommit(ctx, hook(p, "hook")); err != nil {
+					return err
+				}
+				return errFailed
+			},
+			want:    []string{"BEGIN", "ROLLBACK"},
+			wantErr: true,
+		},
+		{
+			name: "failed commit",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				return AfterCommit(ctx, hook(p, "hook"))
+			},
+			exec: func(query string) error {
+				if query == "COMMIT" {
+					return errFailed
+				}
+				return nil
+			},
+			want:    []string{"BEGIN", "COMMIT"},
+			wantErr: true,
+		},
+		{
+			name: "retried serialization failure",
+			fn: func(p *Postgres, ctx context.Context, attempt int) error {
+				if err := AfterCommit(ctx, hook(p, fmt.Sprintf("hook %d", attempt))); err != nil {
+					return err
+				}
+				if attempt == 0 {
+					return fakeError{"40001"}
+				}
+				return nil
+			},
+			want: []string{"BEGIN", "ROLLBACK", "BEGIN", "COMMIT", "hook 1"},
+		},
+		{
+			name: "retries exhausted",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				return fakeError{"40P01"}
+			},
+			want:    []string{"BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK"},
+			wantErr: true,
+		},
+		{
+			name: "not retried",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				return fakeError{"23505"}
+			},
+			want:    []string{"BEGIN", "ROLLBACK"},
+			wantErr: true,
+		},
+		{
+			name: "savepoint",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				err := p.RunInTx(ctx, nil, func(ctx context.Context) error {
+					if _, ok := TxFromContext(ctx); !ok {
+						return errors.New("no transaction in nested context")
+					}
+					return AfterCommit(ctx, hook(p, "nested hook"))
+				})
+				if err != nil {
+					return err
+				}
+				return AfterCommit(ctx, hook(p, "hook"))
+			},
+			want: []string{"BEGIN", "SAVEPOINT", "RELEASE SAVEPOINT", "COMMIT", "nested hook", "hook"},
+		},
+		{
+			name: "rolled back savepoint drops its hooks",
+			fn: func(p *Postgres, ctx context.Context, _ int) error {
+				err := p.RunInTx(ctx, nil, func(ctx context.Context) error {
+					if err := AfterCommit(ctx, hook(p, "nested hook")); err != nil {
+						return err
+					}
+					return errFailed
+				})
+				if !errors.Is(err, errFailed) {
+					return fmt.Errorf("nested RunInTx() error = %v", err)
+				}
+				return AfterCommit(ctx, hook(p, "hook"))
+			},
+			want: []string{"BEGIN", "SAVEPOINT", "ROLLBACK TO SAVEPOINT", "COMMIT", "hook"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &fakeConnector{exec: tt.exec}
+			p := fakePostgres(connector)
+			attempt := 0
+			err := p.RunInTx(context.Background(), nil, func(ctx context.Context) error {
+				defer func() { attempt++ }()
+				return tt.fn(p, ctx, attempt)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunInTx() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := connector.log(); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("RunInTx() statements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestAfterCommitWithoutTx(t *testing.T) {
+	called := false
+	err := AfterCommit(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	if err != nil || !called {
+		t.Errorf("AfterCommit() = %v, called %t, want immediate call", err, called)
+	}
+}
+
+// hook returns AfterCommit hook which records statement to the log of the fake connection
+func hook(p *Postgres, statement string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := p.DB.ExecContext(ctx, statement)
+		return err
+	}
+}